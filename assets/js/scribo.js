@@ -2,4 +2,81 @@
  * Scribo main JavaScript entry point.
  */
 
-console.log("Scribo application ready!");
+(function($) {
+
+  // Color the cells of the latency matrix heatmap from green (fast) to red
+  // (slow), relative to the slowest median latency in the matrix. Pairs with
+  // no pings are left uncolored and pairs with timeouts are outlined.
+  function drawHeatmap(table) {
+    var cells = table.find("td").filter(function() {
+      return parseInt($(this).data("count"), 10) > 0;
+    });
+
+    var max = 0;
+    cells.each(function() {
+      max = Math.max(max, parseFloat($(this).data("median")));
+    });
+
+    cells.each(function() {
+      var cell = $(this);
+      var ratio = max > 0 ? parseFloat(cell.data("median")) / max : 0;
+      var hue = Math.round(120 * (1 - ratio));
+
+      cell.css("background-color", "hsl(" + hue + ", 70%, 75%)");
+      if (parseFloat(cell.data("timeout-rate")) > 0) {
+        cell.css("box-shadow", "inset 0 0 0 2px #c00");
+      }
+    });
+  }
+
+  // Draw the mean and 90th percentile latency of a series of buckets as two
+  // lines on an SVG element, scaled to the window of the series.
+  window.drawSeries = function(svg, series) {
+    var buckets = series.buckets || [];
+    if (buckets.length === 0) {
+      return;
+    }
+
+    var width = svg.width(), height = svg.height(), pad = 20;
+    var start = Date.parse(series.from), end = Date.parse(series.to);
+
+    var max = 0;
+    $.each(buckets, function(i, b) {
+      max = Math.max(max, b.p90, b.mean);
+    });
+
+    function x(b) {
+      return pad + (width - 2 * pad) * (Date.parse(b.time) - start) / (end - start);
+    }
+
+    function y(val) {
+      return height - pad - (height - 2 * pad) * (max > 0 ? val / max : 0);
+    }
+
+    function line(key, dash) {
+      var points = $.map(buckets, function(b) {
+        return x(b).toFixed(1) + "," + y(b[key]).toFixed(1);
+      });
+
+      var el = document.createElementNS("http://www.w3.org/2000/svg", "polyline");
+      el.setAttribute("points", points.join(" "));
+      el.setAttribute("fill", "none");
+      el.setAttribute("stroke", "#d9230f");
+      el.setAttribute("stroke-width", "2");
+      if (dash) {
+        el.setAttribute("stroke-dasharray", "4,4");
+      }
+
+      svg.append(el);
+    }
+
+    line("mean", false);
+    line("p90", true);
+  };
+
+  $(document).ready(function() {
+    drawHeatmap($("#latency-matrix"));
+    console.log("Scribo application ready!");
+  });
+
+})(jQuery);
@@ -2,11 +2,9 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path/filepath"
+	"sort"
 	"strconv"
 
 	"github.com/bbengfort/scribo/scribo"
@@ -18,20 +16,64 @@ func main() {
 	// Instantiate the command line application
 	app := cli.NewApp()
 	app.Name = "scribo-migrate"
-	app.Usage = "executes the latest migration SQL to the database"
+	app.Usage = "applies and reverts versioned migrations to the database"
 	app.Version = scribo.Version
 	app.Author = "Benjamin Bengfort"
 	app.Email = "benjamin@bengfort.com"
-	app.Action = migrateDatabase
+	app.Action = migrateUp
 
 	app.Flags = []cli.Flag{
-		cli.BoolFlag{
-			Name:  "all",
-			Usage: "run all migrations from the beginning",
+		cli.StringFlag{
+			Name:   "config",
+			Value:  "",
+			Usage:  "load settings from a YAML or TOML configuration file",
+			EnvVar: "SCRIBO_CONFIG",
 		},
-		cli.BoolTFlag{
-			Name:  "latest",
-			Usage: "run only the latest migration (default) and exit",
+		cli.StringFlag{
+			Name:  "migrations",
+			Value: "",
+			Usage: "load migrations from this directory instead of the binary",
+		},
+	}
+
+	app.Commands = []cli.Command{
+		{
+			Name:   "up",
+			Usage:  "apply all pending migrations (default)",
+			Action: migrateUp,
+		},
+		{
+			Name:   "down",
+			Usage:  "revert the most recently applied migration",
+			Action: migrateDown,
+		},
+		{
+			Name:   "status",
+			Usage:  "list the migrations and whether they have been applied",
+			Action: migrateStatus,
+		},
+		{
+			Name:      "goto",
+			Usage:     "apply or revert migrations to reach the specified version",
+			ArgsUsage: "VERSION",
+			Action:    migrateGoto,
+		},
+		{
+			Name:      "baseline",
+			Usage:     "record migrations up to VERSION as applied without running them",
+			ArgsUsage: "VERSION",
+			Action:    migrateBaseline,
+		},
+		{
+			Name:   "rekey",
+			Usage:  "generate encrypted keys for nodes with plaintext keys",
+			Action: migrateRekey,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "all",
+					Usage: "generate new keys for every node",
+				},
+			},
 		},
 	}
 
@@ -39,71 +81,194 @@ func main() {
 	app.Run(os.Args)
 }
 
-func migrateDatabase(ctx *cli.Context) error {
-	var rows int64
+// Apply all pending migrations to the database.
+func migrateUp(ctx *cli.Context) error {
+	migrator, err := createMigrator(ctx)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
 
-	// Create a list of files in the migrations directory
-	migrations := loadMigrations()
+	count, err := migrator.Up()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
 
-	// Connect and verify that the connection is open
-	db := scribo.ConnectDB()
-	check(db.Ping())
+	fmt.Printf("Applied %d migrations\n", count)
+	return nil
+}
 
-	if ctx.NArg() > 1 {
-		return cli.NewExitError("Only one migration can be specified at a time.", 1)
+// Revert the most recently applied migration.
+func migrateDown(ctx *cli.Context) error {
+	migrator, err := createMigrator(ctx)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
 	}
 
-	if ctx.NArg() == 1 {
-		idx, err := strconv.Atoi(ctx.Args()[0])
-		check(err)
-		if idx >= len(migrations) {
-			return cli.NewExitError(fmt.Sprintf("No migration #%d", idx), 1)
-		}
+	if err := migrator.Down(); err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	version, err := migrator.Version()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
 
-		rows += executeMigration(migrations[idx], db)
-	} else if ctx.Bool("all") {
-		for _, migration := range migrations {
-			rows += executeMigration(migration, db)
+	fmt.Printf("Reverted database to version %04d\n", version)
+	return nil
+}
+
+// Print the state of every migration to the console.
+func migrateStatus(ctx *cli.Context) error {
+	migrator, err := createMigrator(ctx)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	status, err := migrator.Status()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	for _, s := range status {
+		var state string
+		switch {
+		case s.Modified:
+			state = "MODIFIED"
+		case s.Applied.IsZero():
+			state = "pending"
+		default:
+			state = s.Applied.Format("2006-01-02 15:04:05")
 		}
-	} else if ctx.BoolT("latest") {
-		latest := migrations[len(migrations)-1]
-		rows += executeMigration(latest, db)
-	} else {
-		return cli.NewExitError("No migrations specified to execute!", 1)
+
+		fmt.Printf("%04d  %-30s %s\n", s.Version, s.Name, state)
 	}
 
-	fmt.Printf("Migration changed %d rows\n", rows)
 	return nil
 }
 
-// Load the schema from the migration files.
-func loadMigrations() []string {
+// Apply or revert migrations to reach the version given as an argument.
+func migrateGoto(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return cli.NewExitError("Specify the version to migrate to.", 1)
+	}
+
+	version, err := strconv.Atoi(ctx.Args()[0])
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Could not parse version: %s", err), 1)
+	}
+
+	migrator, err := createMigrator(ctx)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
 
-	// Create a list of files in the migrations directory
-	// BUG(bbengfort): relative import for migrations needs to be configured or searched, not guessed.
-	files, err := filepath.Glob("migrations/[0-9][0-9][0-9][0-9]-*.sql")
-	check(err)
+	count, err := migrator.Goto(version)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
 
-	return files
+	fmt.Printf("Migrated database to version %04d (%d migrations)\n", version, count)
+	return nil
 }
 
-// Execute the migrations to the database.
-func executeMigration(path string, db *sql.DB) int64 {
+// Record the migrations up to the version given as an argument as applied,
+// which adopts a database that was created before migrations were tracked.
+func migrateBaseline(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return cli.NewExitError("Specify the version of the existing schema.", 1)
+	}
 
-	data, err := ioutil.ReadFile(path)
-	check(err)
+	version, err := strconv.Atoi(ctx.Args()[0])
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Could not parse version: %s", err), 1)
+	}
+
+	migrator, err := createMigrator(ctx)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	count, err := migrator.Baseline(version)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	fmt.Printf("Recorded %d migrations as applied, database is at version %04d\n", count, version)
+	return nil
+}
+
+// Generate new random keys that are encrypted with the master key for the
+// nodes whose keys are stored in plaintext, printing the new keys so that
+// they can be given to the nodes.
+func migrateRekey(ctx *cli.Context) error {
+	conf, err := scribo.LoadConfig(ctx.GlobalString("config"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if err := conf.Validate(); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	keys, err := scribo.NewKeyCipher(conf.MasterKey)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	db := scribo.ConnectDB(conf.DatabaseURL)
+	defer db.Close()
+
+	rekeyed, err := scribo.RekeyNodes(db, keys, ctx.Bool("all"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
 
-	result, err := db.Exec(string(data))
-	check(err)
+	names := make([]string, 0, len(rekeyed))
+	for name := range rekeyed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-	rows, err := result.RowsAffected()
-	check(err)
+	for _, name := range names {
+		fmt.Printf("%-30s %s\n", name, rekeyed[name])
+	}
 
-	return rows
+	fmt.Printf("Re-keyed %d nodes\n", len(rekeyed))
+	return nil
 }
 
-func check(e error) {
-	if e != nil {
-		cli.NewExitError(e.Error(), 1)
+// Load the migrations and connect to the database, creating the tracking
+// table for applied migrations if it doesn't exist.
+func createMigrator(ctx *cli.Context) (*scribo.Migrator, error) {
+	files, err := scribo.OpenFiles(scribo.MigrationsDir, ctx.GlobalString("migrations"))
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := scribo.LoadMigrations(files)
+	if err != nil {
+		return nil, err
+	}
+
+	conf, err := scribo.LoadConfig(ctx.GlobalString("config"))
+	if err != nil {
+		return nil, err
 	}
+
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Connect and verify that the connection is open
+	db := scribo.ConnectDB(conf.DatabaseURL)
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	migrator := &scribo.Migrator{DB: db, Migrations: migrations}
+	if err := migrator.Init(); err != nil {
+		return nil, err
+	}
+
+	return migrator, nil
 }
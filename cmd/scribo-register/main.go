@@ -2,8 +2,10 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/bbengfort/scribo/scribo"
 	"github.com/codegangsta/cli"
@@ -23,8 +25,15 @@ func main() {
 	// Create the flags
 	var addr string
 	var dns string
+	var role string
 
 	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Value:  "",
+			Usage:  "load settings from a YAML or TOML configuration file",
+			EnvVar: "SCRIBO_CONFIG",
+		},
 		cli.StringFlag{
 			Name:        "addr",
 			Value:       "",
@@ -37,24 +46,102 @@ func main() {
 			Usage:       "the domain name of the Node",
 			Destination: &dns,
 		},
+		cli.StringFlag{
+			Name:        "role",
+			Value:       "",
+			Usage:       "the role of the Node: admin, reporter (default), or read-only",
+			Destination: &role,
+		},
+	}
+
+	app.Commands = []cli.Command{
+		{
+			Name:      "rotate",
+			Usage:     "issue a new key for a Node and expire its other keys after an overlap",
+			ArgsUsage: "NAME",
+			Action:    rotateKey,
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:  "overlap",
+					Value: 7 * 24 * time.Hour,
+					Usage: "how long the old keys remain valid so the Node can be reconfigured",
+				},
+			},
+		},
+		{
+			Name:      "revoke",
+			Usage:     "expire a key immediately",
+			ArgsUsage: "KEYID",
+			Action:    revokeKey,
+		},
+		{
+			Name:   "token",
+			Usage:  "create a single-use token that a new Node can enroll itself with",
+			Action: createToken,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "role",
+					Value: scribo.RoleReporter,
+					Usage: "the role of the enrolled Node: admin, reporter, or read-only",
+				},
+				cli.DurationFlag{
+					Name:  "ttl",
+					Value: scribo.EnrollmentTokenTTL,
+					Usage: "how long the token can be used",
+				},
+			},
+		},
+		{
+			Name:      "list-keys",
+			Usage:     "list the keys of a Node and when they expire",
+			ArgsUsage: "NAME",
+			Action:    listKeys,
+		},
 	}
 
 	// Run the command line application
 	app.Run(os.Args)
 }
 
-// The primary action of the scribo-register command
+// Helper function that loads the configuration and connects to the database
+// with the cipher that encrypts the node keys.
+func connect(ctx *cli.Context) (*sql.DB, *scribo.KeyCipher, error) {
+	conf, err := scribo.LoadConfig(ctx.GlobalString("config"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := conf.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	keys, err := scribo.NewKeyCipher(conf.MasterKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return scribo.ConnectDB(conf.DatabaseURL), keys, nil
+}
+
+// The primary action of the scribo-register command, which creates or
+// updates a node. New nodes are issued a key; the keys of existing nodes are
+// not changed, use the rotate command to issue them a new key.
 func registerUser(ctx *cli.Context) error {
 	if ctx.NArg() == 1 {
-		db := scribo.ConnectDB()
+		db, keys, err := connect(ctx)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		defer db.Close()
+
 		name := ctx.Args()[0]
 
 		// Get the Node out of the database
 		node, err := scribo.GetNodeByName(db, name)
 
-		// If the error is not nill, this is not simply does not exist
-		if err != nil {
-			cli.NewExitError(err.Error(), 2)
+		// If the node does not exist, a new one will be created
+		if err != nil && !scribo.IsNotFound(err) {
+			return cli.NewExitError(err.Error(), 2)
 		}
 
 		// Now we either have a new node or we are updating an old one.
@@ -70,23 +157,12 @@ func registerUser(ctx *cli.Context) error {
 			node.DNS = dns
 		}
 
-		// Reset the API key for the node.
-		node.UpdateKey()
-
-		// Now save the Node changes back to the database.
-		created, err := node.Save(db)
-		if err != nil {
-			cli.NewExitError(err.Error(), 3)
+		role := ctx.String("role")
+		if role != "" {
+			node.Role = role
 		}
 
 		// Print the node back to the console.
-		var createStr string
-		if created {
-			createStr = "Created"
-		} else {
-			createStr = "Updated"
-		}
-
 		var addrStr string
 		if node.Address != "" {
 			addrStr = node.Address
@@ -96,7 +172,23 @@ func registerUser(ctx *cli.Context) error {
 			addrStr = "Unknown Address"
 		}
 
-		fmt.Printf("%s Node %s (%s)\nKey: %s\n\n", createStr, node.Name, addrStr, node.Key)
+		// Save the changes to an existing node back to the database.
+		if node.ID > 0 {
+			if _, err := node.Save(db); err != nil {
+				return cli.NewExitError(err.Error(), 3)
+			}
+
+			fmt.Printf("Updated Node %s (%s) as %s\nUse `scribo-register rotate %s` to issue a new key.\n\n", node.Name, addrStr, node.Role, node.Name)
+			return nil
+		}
+
+		// Create the new node with its first API key in one transaction.
+		key, plaintext, err := scribo.CreateNode(db, keys, &node)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 3)
+		}
+
+		fmt.Printf("Created Node %s (%s) as %s\nKey ID: %s\nKey: %s\n\n", node.Name, addrStr, node.Role, key.KeyID, plaintext)
 		return nil
 
 	} else if ctx.NArg() > 1 {
@@ -105,3 +197,109 @@ func registerUser(ctx *cli.Context) error {
 
 	return cli.NewExitError("Supply the name of the node to register.", 1)
 }
+
+// Issue a new key for a node, expiring its other keys after the overlap.
+func rotateKey(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return cli.NewExitError("Supply the name of the node to rotate the key of.", 1)
+	}
+
+	db, keys, err := connect(ctx)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	defer db.Close()
+
+	node, err := scribo.GetNodeByName(db, ctx.Args()[0])
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	overlap := ctx.Duration("overlap")
+	key, plaintext, err := scribo.RotateNodeKey(db, keys, node, overlap)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 3)
+	}
+
+	fmt.Printf("Rotated key of Node %s, the old keys expire at %s\nKey ID: %s\nKey: %s\n\n", node.Name, time.Now().Add(overlap).Format(time.RFC3339), key.KeyID, plaintext)
+	return nil
+}
+
+// Expire a key immediately.
+func revokeKey(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return cli.NewExitError("Supply the ID of the key to revoke.", 1)
+	}
+
+	db, _, err := connect(ctx)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	defer db.Close()
+
+	keyID := ctx.Args()[0]
+	if err := scribo.RevokeNodeKey(db, keyID); err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	fmt.Printf("Revoked key %s\n", keyID)
+	return nil
+}
+
+// Print the keys of a node and whether they have expired to the console.
+func listKeys(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return cli.NewExitError("Supply the name of the node to list the keys of.", 1)
+	}
+
+	db, _, err := connect(ctx)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	defer db.Close()
+
+	node, err := scribo.GetNodeByName(db, ctx.Args()[0])
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	keys, err := scribo.FetchNodeKeys(db, node.ID)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	now := time.Now()
+	for _, key := range keys {
+		var state, expires string
+		switch {
+		case key.Expires == nil:
+			state, expires = "active", "never"
+		case key.Active(now):
+			state, expires = "expiring", key.Expires.Format(time.RFC3339)
+		default:
+			state, expires = "expired", key.Expires.Format(time.RFC3339)
+		}
+
+		fmt.Printf("%-16s  %-8s  created %s  expires %s\n", key.KeyID, state, key.Created.Format(time.RFC3339), expires)
+	}
+
+	return nil
+}
+
+// Create an enrollment token that a new node exchanges for its credentials
+// with POST /enroll.
+func createToken(ctx *cli.Context) error {
+	db, _, err := connect(ctx)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	defer db.Close()
+
+	token, err := scribo.CreateEnrollmentToken(db, ctx.String("role"), ctx.Duration("ttl"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 3)
+	}
+
+	fmt.Printf("Created enrollment token for a %s Node, expires at %s\nToken: %s\n\n", token.Role, token.Expires.Format(time.RFC3339), token.Token)
+	return nil
+}
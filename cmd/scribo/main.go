@@ -19,15 +19,52 @@ func main() {
 	app.Action = runScriboApp
 
 	// Create the flags
-	var port int
-
 	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Value:  "",
+			Usage:  "load settings from a YAML or TOML configuration file",
+			EnvVar: "SCRIBO_CONFIG",
+		},
+		cli.IntFlag{
+			Name:  "port",
+			Value: 5356,
+			Usage: "the PORT to run the HTTP server on (overrides $PORT)",
+		},
+		cli.StringFlag{
+			Name:  "tls-cert",
+			Value: "",
+			Usage: "serve HTTPS using the PEM encoded certificate at this path",
+		},
+		cli.StringFlag{
+			Name:  "tls-key",
+			Value: "",
+			Usage: "serve HTTPS using the PEM encoded private key at this path",
+		},
 		cli.IntFlag{
-			Name:        "port",
-			Value:       5356,
-			Usage:       "the PORT to run the HTTP server on",
-			EnvVar:      "PORT",
-			Destination: &port,
+			Name:  "redirect-port",
+			Value: 0,
+			Usage: "redirect HTTP requests on this port to HTTPS",
+		},
+		cli.StringFlag{
+			Name:  "log-level",
+			Value: "info",
+			Usage: "the minimum level of log entries: debug, info, warn or error",
+		},
+		cli.StringFlag{
+			Name:  "log-format",
+			Value: "text",
+			Usage: "write log entries as text or json",
+		},
+		cli.StringFlag{
+			Name:  "access-log",
+			Value: "dev",
+			Usage: "the format of requests in the log: dev, common or combined",
+		},
+		cli.StringFlag{
+			Name:  "root",
+			Value: "",
+			Usage: "serve templates and assets from this directory instead of the binary",
 		},
 	}
 
@@ -35,7 +72,53 @@ func main() {
 	app.Run(os.Args)
 }
 
-func runScriboApp(ctx *cli.Context) {
-	server := scribo.CreateApp()
-	server.Run(ctx.Int("port"))
+func runScriboApp(ctx *cli.Context) error {
+	conf, err := scribo.LoadConfig(ctx.String("config"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	// Command line flags take precedence over all other settings.
+	if ctx.IsSet("port") {
+		conf.Port = ctx.Int("port")
+	}
+
+	if ctx.IsSet("root") {
+		conf.Root = ctx.String("root")
+	}
+
+	if ctx.IsSet("tls-cert") {
+		conf.TLSCert = ctx.String("tls-cert")
+	}
+
+	if ctx.IsSet("tls-key") {
+		conf.TLSKey = ctx.String("tls-key")
+	}
+
+	if ctx.IsSet("redirect-port") {
+		conf.RedirectPort = ctx.Int("redirect-port")
+	}
+
+	if ctx.IsSet("log-level") {
+		conf.LogLevel = ctx.String("log-level")
+	}
+
+	if ctx.IsSet("log-format") {
+		conf.LogFormat = ctx.String("log-format")
+	}
+
+	if ctx.IsSet("access-log") {
+		conf.AccessLog = ctx.String("access-log")
+	}
+
+	server, err := scribo.CreateApp(conf)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if err := server.Run(); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	return nil
 }
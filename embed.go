@@ -0,0 +1,11 @@
+// Package scribo embeds the database migrations, HTML templates, and static
+// assets in the Scribo binaries so that the commands can be run from any
+// working directory. The library and commands are in the scribo subpackage.
+package scribo
+
+import "embed"
+
+// Files contains the migrations, templates, and assets directories.
+//
+//go:embed migrations/*.sql templates assets
+var Files embed.FS
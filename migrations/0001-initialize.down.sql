@@ -0,0 +1,15 @@
+/**
+ * 0001-initialize.down.sql
+ * Copyright 2016 University of Maryland
+ *
+ * Author:  Benjamin Bengfort <benjamin@bengfort.com>
+ * Created: Sat Oct 17 09:12:31 2026 -0400
+ */
+
+-------------------------------------------------------------------------
+-- Reverts 0001-initialize.sql by dropping the entity tables; the foreign
+-- keys and indices are dropped along with the tables.
+-------------------------------------------------------------------------
+
+DROP TABLE IF EXISTS "pings" CASCADE;
+DROP TABLE IF EXISTS "nodes" CASCADE;
@@ -7,12 +7,11 @@
  */
 
 -------------------------------------------------------------------------
--- Ensure transaction security by placing all CREATE and ALTER statements
--- inside of `BEGIN` and `COMMIT` statements.
+-- Transactions are managed by scribo-migrate, which executes each migration
+-- and records it in the `schema_migrations` table in a single transaction,
+-- so there should be no `BEGIN` or `COMMIT` statements in this file.
 -------------------------------------------------------------------------
 
-BEGIN;
-
 /**
  *  CREATE ENTITY TABLES
  */
@@ -96,9 +95,3 @@ CREATE TABLE "pings"
  /**
   *  CREATE INDICIES
   */
-
- COMMIT;
-
- -------------------------------------------------------------------------
- -- No CREATE or ALTER statements should be outside of the `COMMIT`.
- -------------------------------------------------------------------------
@@ -0,0 +1,13 @@
+/**
+ * 0002-hawk-nonces.down.sql
+ * Copyright 2016 University of Maryland
+ *
+ * Author:  Benjamin Bengfort <benjamin@bengfort.com>
+ * Created: Sat Oct 17 10:41:08 2026 -0400
+ */
+
+-------------------------------------------------------------------------
+-- Reverts 0002-hawk-nonces.sql by dropping the nonces table.
+-------------------------------------------------------------------------
+
+DROP TABLE IF EXISTS "hawk_nonces";
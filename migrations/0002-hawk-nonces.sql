@@ -0,0 +1,23 @@
+/**
+ * 0002-hawk-nonces.sql
+ * Copyright 2016 University of Maryland
+ *
+ * Author:  Benjamin Bengfort <benjamin@bengfort.com>
+ * Created: Sat Oct 17 10:41:08 2026 -0400
+ */
+
+-------------------------------------------------------------------------
+-- hawk_nonces Table
+-------------------------------------------------------------------------
+
+-- Records the nonces of Hawk signed requests until they expire so that the
+-- requests cannot be replayed when scribo is run with `nonce_store: postgres`.
+CREATE TABLE "hawk_nonces"
+(
+    "node" VARCHAR(255) NOT NULL,
+    "nonce" VARCHAR(255) NOT NULL,
+    "expires" TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY ("node", "nonce")
+);
+
+CREATE INDEX "hawk_nonces_expires_idx" ON "hawk_nonces" ("expires");
@@ -0,0 +1,13 @@
+/**
+ * 0003-node-roles.down.sql
+ * Copyright 2016 University of Maryland
+ *
+ * Author:  Benjamin Bengfort <benjamin@bengfort.com>
+ * Created: Sat Oct 17 11:27:54 2026 -0400
+ */
+
+-------------------------------------------------------------------------
+-- Reverts 0003-node-roles.sql by dropping the role of the nodes.
+-------------------------------------------------------------------------
+
+ALTER TABLE "nodes" DROP COLUMN IF EXISTS "role";
@@ -0,0 +1,17 @@
+/**
+ * 0003-node-roles.sql
+ * Copyright 2016 University of Maryland
+ *
+ * Author:  Benjamin Bengfort <benjamin@bengfort.com>
+ * Created: Sat Oct 17 11:27:54 2026 -0400
+ */
+
+-------------------------------------------------------------------------
+-- nodes Table
+-------------------------------------------------------------------------
+
+-- The role determines which methods of the API a node is permitted to use.
+-- Existing nodes become reporters, so admins must be granted their role with
+-- `scribo-register --role admin NAME` after the migration.
+ALTER TABLE "nodes" ADD COLUMN "role" VARCHAR(16) NOT NULL DEFAULT 'reporter'
+    CONSTRAINT "nodes_role_check" CHECK ("role" IN ('admin', 'reporter', 'read-only'));
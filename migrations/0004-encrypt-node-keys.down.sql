@@ -0,0 +1,16 @@
+/**
+ * 0004-encrypt-node-keys.down.sql
+ * Copyright 2016 University of Maryland
+ *
+ * Author:  Benjamin Bengfort <benjamin@bengfort.com>
+ * Created: Sat Oct 17 12:06:13 2026 -0400
+ */
+
+-------------------------------------------------------------------------
+-- Reverts 0004-encrypt-node-keys.sql; the encrypted keys don't fit in the
+-- original column, so they are removed and the nodes must be registered
+-- again with `scribo-register` to receive new keys.
+-------------------------------------------------------------------------
+
+UPDATE "nodes" SET "key" = '' WHERE "key" LIKE 'v1:%';
+ALTER TABLE "nodes" ALTER COLUMN "key" TYPE VARCHAR(44);
@@ -0,0 +1,17 @@
+/**
+ * 0004-encrypt-node-keys.sql
+ * Copyright 2016 University of Maryland
+ *
+ * Author:  Benjamin Bengfort <benjamin@bengfort.com>
+ * Created: Sat Oct 17 12:06:13 2026 -0400
+ */
+
+-------------------------------------------------------------------------
+-- nodes Table
+-------------------------------------------------------------------------
+
+-- Node keys are stored encrypted with the master key, which is longer than
+-- the plaintext keys. The master key is not available to the migrations, so
+-- the nodes with plaintext keys must be re-keyed after this migration with
+-- `scribo-migrate rekey`; those nodes cannot authenticate until they are.
+ALTER TABLE "nodes" ALTER COLUMN "key" TYPE VARCHAR(255);
@@ -0,0 +1,24 @@
+/**
+ * 0005-node-keys.down.sql
+ * Copyright 2016 University of Maryland
+ *
+ * Author:  Benjamin Bengfort <benjamin@bengfort.com>
+ * Created: Sat Oct 17 13:22:41 2026 -0400
+ */
+
+-------------------------------------------------------------------------
+-- Reverts 0005-node-keys.sql; each node keeps its newest unexpired key and
+-- the clients using any of its other keys must be reconfigured.
+-------------------------------------------------------------------------
+
+ALTER TABLE "nodes" ADD COLUMN "key" VARCHAR(255) DEFAULT '';
+
+UPDATE "nodes" SET "key" = "latest"."key"
+    FROM (
+        SELECT DISTINCT ON ("node_id") "node_id", "key" FROM "node_keys"
+        WHERE "expires" IS NULL OR "expires" > now()
+        ORDER BY "node_id", "created" DESC, "id" DESC
+    ) AS "latest"
+    WHERE "nodes"."id" = "latest"."node_id";
+
+DROP TABLE IF EXISTS "node_keys";
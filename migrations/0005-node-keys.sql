@@ -0,0 +1,38 @@
+/**
+ * 0005-node-keys.sql
+ * Copyright 2016 University of Maryland
+ *
+ * Author:  Benjamin Bengfort <benjamin@bengfort.com>
+ * Created: Sat Oct 17 13:22:41 2026 -0400
+ */
+
+-------------------------------------------------------------------------
+-- node_keys Table
+-------------------------------------------------------------------------
+
+-- Nodes can have more than one key so that a key can be rotated without
+-- breaking the clients that still sign their requests with the old key. Each
+-- key has a Hawk key ID and is valid until it expires (NULL never expires).
+CREATE TABLE "node_keys"
+(
+    "id" SERIAL NOT NULL PRIMARY KEY,
+    "key_id" VARCHAR(64) NOT NULL UNIQUE,
+    "node_id" INT NOT NULL REFERENCES "nodes" ("id") ON DELETE CASCADE,
+    "key" VARCHAR(255) NOT NULL,
+    "created" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "expires" TIMESTAMP WITH TIME ZONE DEFAULT NULL
+);
+
+CREATE INDEX "idx_node_keys_node_id" ON "node_keys" USING BTREE ("node_id");
+
+-- Move the existing keys of the nodes into the new table with random key IDs.
+-- Plaintext keys are moved as well so that `scribo-migrate rekey` finds them.
+INSERT INTO "node_keys" ("key_id", "node_id", "key", "created")
+    SELECT substr(md5(random()::text || "id"::text), 1, 16), "id", "key", "updated"
+    FROM "nodes" WHERE "key" <> '';
+
+-------------------------------------------------------------------------
+-- nodes Table
+-------------------------------------------------------------------------
+
+ALTER TABLE "nodes" DROP COLUMN "key";
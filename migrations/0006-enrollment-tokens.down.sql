@@ -0,0 +1,14 @@
+/**
+ * 0006-enrollment-tokens.down.sql
+ * Copyright 2016 University of Maryland
+ *
+ * Author:  Benjamin Bengfort <benjamin@bengfort.com>
+ * Created: Sat Oct 17 14:48:19 2026 -0400
+ */
+
+-------------------------------------------------------------------------
+-- Reverts 0006-enrollment-tokens.sql by dropping the tokens table; nodes
+-- that were enrolled with the tokens are not affected.
+-------------------------------------------------------------------------
+
+DROP TABLE IF EXISTS "enrollment_tokens";
@@ -0,0 +1,26 @@
+/**
+ * 0006-enrollment-tokens.sql
+ * Copyright 2016 University of Maryland
+ *
+ * Author:  Benjamin Bengfort <benjamin@bengfort.com>
+ * Created: Sat Oct 17 14:48:19 2026 -0400
+ */
+
+-------------------------------------------------------------------------
+-- enrollment_tokens Table
+-------------------------------------------------------------------------
+
+-- Single-use tokens that new nodes exchange for their Hawk credentials at
+-- `POST /enroll`. Only the SHA-256 hash of each token is stored; a token is
+-- consumed by setting "used" and records the node that was enrolled with it.
+CREATE TABLE "enrollment_tokens"
+(
+    "id" SERIAL NOT NULL PRIMARY KEY,
+    "token_hash" VARCHAR(64) NOT NULL UNIQUE,
+    "role" VARCHAR(16) NOT NULL DEFAULT 'reporter'
+        CONSTRAINT "enrollment_tokens_role_check" CHECK ("role" IN ('admin', 'reporter', 'read-only')),
+    "created" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "expires" TIMESTAMP WITH TIME ZONE NOT NULL,
+    "used" TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    "node_id" INT DEFAULT NULL REFERENCES "nodes" ("id") ON DELETE SET NULL
+);
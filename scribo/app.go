@@ -4,23 +4,28 @@
 //
 // The package is implemented by three commands: scribo, scribo-migrate, and scribo-register. To run the application locally:
 //
-//     $ scribo-migrate --all
+//     $ scribo-migrate up
 //     $ scribo -port 8080
 //
 // So long as you have environment variables configured correctly, the database should be created and the web application will run. See the README for more information on getting started.
 package scribo
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"html/template"
-	"log"
+	"io/fs"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"strconv"
+	"syscall"
 
+	gorilla "github.com/gorilla/context"
 	"github.com/gorilla/mux"
 )
 
@@ -31,30 +36,85 @@ const Version = "1.0"
 // router for multiplexing, storages, assets, templates, cookies, and more.
 // This should be the primary interface for working with Scribo.
 type App struct {
-	StaticDir   string
-	TemplateDir string
+	Config      *Config
+	StaticDir   string // Serve assets from disk rather than the binary
+	TemplateDir string // Load templates from disk rather than the binary
 	Templates   *template.Template
 	Router      *mux.Router
 	DB          *sql.DB
+	Log         *Log
+	Metrics     *Metrics
+	Nonces      NonceStore // Prevents signed requests from being replayed
+	Keys        *KeyCipher // Decrypts the keys of the nodes
+
+	// The version of the migrations embedded in the binary, which the
+	// database must be migrated to for the app to be ready.
+	SchemaVersion int
 }
 
-// CreateApp allows you to easily instantiate an App instance.
-func CreateApp() *App {
+// CreateApp allows you to easily instantiate an App instance from a config,
+// which is validated before the app is created. The templates and static
+// assets are embedded in the binary; if a root directory is configured, they
+// are loaded from its templates and assets directories instead, which is
+// useful for development.
+func CreateApp(conf *Config) (*App, error) {
+	// Ensure the configuration is valid before using it
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
 	// Instantiate the app
 	app := new(App)
+	app.Config = conf
 
-	// Connect to the database
-	app.DB = ConnectDB()
+	// Create the log from the validated configuration
+	level, _ := ParseLogLevel(conf.LogLevel)
+	app.Log = NewLog(os.Stderr, level, conf.LogFormat)
+	app.Metrics = NewMetrics()
 
-	// Set the static and template directories
-	// BUG(bbengfort): relative import for static/template directories needs to be configured rather than guessed.
-	root, _ := os.Getwd()
-	app.StaticDir = path.Join(root, "assets")
-	app.TemplateDir = path.Join(root, "templates")
+	// The master key is required to decrypt the keys of the nodes
+	var err error
+	if app.Keys, err = NewKeyCipher(conf.MasterKey); err != nil {
+		return nil, err
+	}
+
+	// Set the static and template directories if they're on disk
+	if conf.Root != "" {
+		app.StaticDir = path.Join(conf.Root, AssetsDir)
+		app.TemplateDir = path.Join(conf.Root, TemplatesDir)
+	}
 
 	// Load the templates from the template directory
-	tmplGlob := path.Join(app.TemplateDir, "*")
-	app.Templates = template.Must(template.ParseGlob(tmplGlob))
+	templates, err := OpenFiles(TemplatesDir, app.TemplateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if app.Templates, err = template.ParseFS(templates, "*"); err != nil {
+		return nil, err
+	}
+
+	// Open the static assets to be served by the file server
+	assets, err := OpenFiles(AssetsDir, app.StaticDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Determine the schema version that the app expects the database to have
+	files, err := OpenFiles(MigrationsDir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := LoadMigrations(files)
+	if err != nil {
+		return nil, err
+	}
+	app.SchemaVersion = migrations.Latest()
+
+	// Connect to the database
+	app.DB = ConnectDB(conf.DatabaseURL)
+	app.Nonces = NewNonceStore(conf, app.DB)
 
 	app.Router = mux.NewRouter().StrictSlash(true)
 
@@ -64,13 +124,16 @@ func CreateApp() *App {
 	}
 
 	// Add a static file server pointing at the assets directory
-	app.AddStatic(app.StaticDir)
+	app.AddStatic(assets)
 
-	return app
+	return app, nil
 }
 
-// Run the web application via the associated router.
-func (app *App) Run(port int) {
+// Run the web application via the associated router on the configured port.
+// Run blocks until the process receives a SIGINT or SIGTERM, then gracefully
+// shuts down the server and closes the database connection.
+func (app *App) Run() error {
+	port := app.Config.Port
 	addr := fmt.Sprintf(":%d", port)
 
 	name, err := os.Hostname()
@@ -78,8 +141,98 @@ func (app *App) Run(port int) {
 		name = "localhost"
 	}
 
-	log.Printf("Starting server at http://%s:%d (use CTRL+C to quit)", name, port)
-	log.Fatal(http.ListenAndServe(addr, app.Router))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	// Redirect plain HTTP requests to HTTPS on a second port if configured
+	if app.Config.RedirectPort != 0 {
+		redirect, err := net.Listen("tcp", fmt.Sprintf(":%d", app.Config.RedirectPort))
+		if err != nil {
+			listener.Close()
+			return err
+		}
+
+		server := &http.Server{
+			Handler:      gorilla.ClearHandler(Logger(app, RedirectHTTPS(app))),
+			ReadTimeout:  app.Config.ReadTimeout,
+			WriteTimeout: app.Config.WriteTimeout,
+			IdleTimeout:  app.Config.IdleTimeout,
+		}
+
+		go server.Serve(redirect)
+		defer server.Close()
+
+		app.Log.Infof("Redirecting http://%s:%d to HTTPS", name, app.Config.RedirectPort)
+	}
+
+	// Stop the server when the process is interrupted or terminated
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	scheme := "http"
+	if app.Config.TLS() {
+		scheme = "https"
+	}
+
+	app.Log.Infof("Starting server at %s://%s:%d (use CTRL+C to quit)", scheme, name, port)
+	return app.Serve(listener, stop)
+}
+
+// Serve handles requests on the listener until a signal is received on the
+// stop channel. In-flight requests are then given until the configured
+// shutdown timeout to complete before their connections are closed. The
+// database connection is closed when the server stops. If a TLS certificate
+// is configured, requests are served over HTTPS with the HSTS header.
+func (app *App) Serve(listener net.Listener, stop <-chan os.Signal) error {
+	// Close the database after the server is no longer handling requests
+	defer app.DB.Close()
+
+	tlsConfig, err := app.LoadTLSConfig()
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	server := &http.Server{
+		Handler:      app.Router,
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  app.Config.ReadTimeout,
+		WriteTimeout: app.Config.WriteTimeout,
+		IdleTimeout:  app.Config.IdleTimeout,
+	}
+
+	if tlsConfig != nil {
+		server.Handler = StrictTransport(app, app.Router)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			errs <- server.ServeTLS(listener, "", "")
+		} else {
+			errs <- server.Serve(listener)
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-stop:
+		app.Log.Infof("Received %s, shutting down server (waiting up to %s)", sig, app.Config.ShutdownTimeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), app.Config.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
+		return fmt.Errorf("could not drain connections: %s", err)
+	}
+
+	return nil
 }
 
 // AddRoute allows you to add a handler for a specific route to the router.
@@ -91,6 +244,8 @@ func (app *App) AddRoute(route Route) {
 		handler = Authenticate(app, handler)
 	}
 
+	handler = Recover(app, handler)
+	handler = Instrument(app, route.Name, handler)
 	handler = Logger(app, handler)
 	// handler = Debugger(app, handler)
 
@@ -102,8 +257,8 @@ func (app *App) AddRoute(route Route) {
 }
 
 // AddStatic creates a handler to serve static files.
-func (app *App) AddStatic(staticDir string) {
-	static := http.StripPrefix("/assets/", http.FileServer(http.Dir(staticDir)))
+func (app *App) AddStatic(assets fs.FS) {
+	static := http.StripPrefix("/assets/", http.FileServer(http.FS(assets)))
 	app.Router.PathPrefix("/assets/").Handler(Logger(app, static))
 }
 
@@ -132,17 +287,29 @@ func (app *App) JSONAbort(w http.ResponseWriter, statusCode int) {
 	}
 }
 
-// JSONError is a handler to terminate the request with a JSON response
+// JSONError is a handler to terminate the request with a JSON response. If
+// the error is a validation error, the reason each field is invalid is also
+// included in the response.
 func (app *App) JSONError(w http.ResponseWriter, err error, statusCode int) {
 	w.Header().Set(CTKEY, CTJSON)
 	w.WriteHeader(statusCode)
 
-	response := make(map[string]string)
+	if err := json.NewEncoder(w).Encode(errorResponse(err, statusCode)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// Helper function that creates the JSON response for an error, including the
+// reason each field is invalid if the error is a validation error.
+func errorResponse(err error, statusCode int) map[string]interface{} {
+	response := make(map[string]interface{})
 	response["code"] = strconv.Itoa(statusCode)
 	response["error"] = err.Error()
 
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if fields := validationFields(err); fields != nil {
+		response["fields"] = fields
 	}
+
+	return response
 }
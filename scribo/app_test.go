@@ -1,22 +1,165 @@
 package scribo_test
 
 import (
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"time"
 
 	. "github.com/bbengfort/scribo/scribo"
 
 	. "github.com/onsi/ginkgo"
-	// . "github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("App", func() {
 
+	var conf *Config
+
+	BeforeEach(func() {
+		conf = DefaultConfig()
+		conf.DatabaseURL = os.Getenv("TEST_DATABASE_URL")
+		conf.MasterKey = testMasterKey
+	})
+
+	It("should not create an app with an invalid config", func() {
+		conf.DatabaseURL = ""
+		_, err := CreateApp(conf)
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should load the templates embedded in the binary", func() {
+		app, err := CreateApp(conf)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(app.Config).Should(Equal(conf))
+		Ω(app.TemplateDir).Should(BeEmpty())
+		Ω(app.Templates.Lookup("index")).ShouldNot(BeNil())
+	})
+
+	It("should load the templates and assets from a root directory", func() {
+		conf.Root = ".."
+		app, err := CreateApp(conf)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(app.TemplateDir).Should(Equal("../templates"))
+		Ω(app.Templates.Lookup("index")).ShouldNot(BeNil())
+
+		request, _ := http.NewRequest(GET, "/assets/js/scribo.js", nil)
+		response := httptest.NewRecorder()
+		app.Router.ServeHTTP(response, request)
+		Ω(response.Code).Should(Equal(http.StatusOK))
+	})
+
+	It("should not create an app from a missing root directory", func() {
+		conf.Root = "/does/not/exist"
+		_, err := CreateApp(conf)
+		Ω(err).Should(HaveOccurred())
+	})
+
+	Describe("serving requests", func() {
+
+		var server *App
+		var listener net.Listener
+		var stop chan os.Signal
+		var done chan error
+
+		BeforeEach(func() {
+			var err error
+			server, err = CreateApp(conf)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			// Add a slow route to test draining in-flight requests
+			server.Router.Handle("/slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(200 * time.Millisecond)
+				w.Write([]byte("done"))
+			}))
+
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			stop = make(chan os.Signal, 1)
+			done = make(chan error, 1)
+		})
+
+		// Helper to make a slow request, then stop the server mid-request.
+		slowRequest := func() (*http.Response, error) {
+			go func() {
+				done <- server.Serve(listener, stop)
+			}()
+
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				stop <- syscall.SIGTERM
+			}()
+
+			return http.Get("http://" + listener.Addr().String() + "/slow")
+		}
+
+		It("should drain in-flight requests when stopped", func() {
+			response, err := slowRequest()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer response.Body.Close()
+
+			body, err := ioutil.ReadAll(response.Body)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(body)).Should(Equal("done"))
+
+			Eventually(done).Should(Receive(BeNil()))
+			Ω(server.DB.Ping()).Should(HaveOccurred())
+		})
+
+		It("should close connections after the shutdown timeout", func() {
+			server.Config.ShutdownTimeout = 10 * time.Millisecond
+			slowRequest()
+
+			var err error
+			Eventually(done).Should(Receive(&err))
+			Ω(err).Should(HaveOccurred())
+			Ω(server.DB.Ping()).Should(HaveOccurred())
+		})
+
+	})
+
 })
 
+// The master key that encrypts the keys of the nodes in the tests.
+const testMasterKey = "c2NyaWJvLXRlc3QtbWFzdGVyLWtleS0zMi1ieXRlcyE="
+
+// Helper function that encrypts a node key with the test master key.
+func encryptedKey(key string) string {
+	keys, err := NewKeyCipher(testMasterKey)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	stored, err := keys.Encrypt(key)
+	Ω(err).ShouldNot(HaveOccurred())
+	return stored
+}
+
+// Helper function that saves a key for the node that never expires.
+func createNodeKey(node Node, key string) NodeKey {
+	nodeKey := NodeKey{NodeID: node.ID, Key: encryptedKey(key)}
+	Ω(nodeKey.Save(db)).Should(Succeed())
+	return nodeKey
+}
+
+// Helper function that saves a node with a key that never expires.
+func createNode(node Node, key string) Node {
+	_, err := node.Save(db)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	createNodeKey(node, key)
+	return node
+}
+
 func createTestApp() *App {
 	app := new(App)
 
+	app.Config = DefaultConfig()
+	app.Config.MasterKey = testMasterKey
 	app.DB = db
+	app.Keys, _ = NewKeyCipher(testMasterKey)
 
 	return app
 }
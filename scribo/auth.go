@@ -2,47 +2,163 @@ package scribo
 
 import (
 	"crypto/sha256"
-	"database/sql"
-	"encoding/base64"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/gorilla/context"
 	"github.com/tent/hawk-go"
 )
 
-// Helper function that looks up a Node's credentials by their name.
+// Keys used to store values in the request context.
+type contextKey int
+
+const (
+	nodeKey      contextKey = iota // The authenticated node
+	requestIDKey                   // The ID that identifies the request in the logs
+	hawkAuthKey                    // The Hawk authorization, needed to sign the response
+)
+
+// AuthenticatedNode returns the node that signed the request, if the request
+// was authenticated by the Authenticate decorator.
+func AuthenticatedNode(r *http.Request) (Node, bool) {
+	node, ok := context.Get(r, nodeKey).(Node)
+	return node, ok
+}
+
+// The node that a request may be signed by and the plaintext keys that it
+// may be signed with, stored in the Data field of the Hawk credentials.
+type nodeCredentials struct {
+	node Node
+	keys []string
+}
+
+// Helper function that returns an unknown ID error for the credentials.
+func unknownCredentials(c *hawk.Credentials) error {
+	err := new(hawk.CredentialError)
+	err.Type = hawk.UnknownID
+	err.Credentials = c
+	return err
+}
+
+// Helper function that looks up a Node's credentials by the Hawk ID of the
+// request, which is either the key ID of one of the node's keys or the name
+// of the node, in which case all of the node's unexpired keys are candidates.
+// The keys are decrypted and stored with the node in the Data field of the
+// credentials for use during validation. Keys that can't be decrypted are
+// skipped and only reported in the log.
 func getCredentials(app *App, c *hawk.Credentials) error {
-	var key string
+	if app.Keys == nil {
+		return errors.New("cannot authenticate nodes without a master key")
+	}
 
-	// Lookup node by name (the ID specified in the request)
-	query := "SELECT key FROM nodes WHERE name=$1"
-	row := app.DB.QueryRow(query, c.ID)
-	err := row.Scan(&key)
+	var (
+		node Node
+		keys []NodeKey
+	)
+
+	// Lookup the key by its key ID and then the node by name
+	key, err := GetNodeKey(app.DB, c.ID)
+	switch {
+	case err == nil:
+		if !key.Active(time.Now()) {
+			return unknownCredentials(c)
+		}
+
+		if node, err = GetNode(app.DB, key.NodeID); err != nil {
+			return err
+		}
+		keys = []NodeKey{key}
 
-	if err != nil {
+	case IsNotFound(err):
+		node, err = GetNodeByName(app.DB, c.ID)
+		if IsNotFound(err) {
+			return unknownCredentials(c)
+		}
 
-		if err == sql.ErrNoRows {
-			err := new(hawk.CredentialError)
-			err.Type = hawk.UnknownID
-			err.Credentials = c
+		if err != nil {
+			return err
+		}
 
+		if keys, err = FetchActiveNodeKeys(app.DB, node.ID); err != nil {
 			return err
 		}
 
+	default:
 		return err
 	}
 
+	creds := &nodeCredentials{node: node}
+	for _, key := range keys {
+		plaintext, err := app.Keys.Decrypt(key.Key)
+		if err != nil {
+			app.Log.Warnf("cannot authenticate node %q with key %s: %s", node.Name, key.KeyID, err)
+			continue
+		}
+		creds.keys = append(creds.keys, plaintext)
+	}
+
+	if len(creds.keys) == 0 {
+		return unknownCredentials(c)
+	}
+
 	// Otherwise we're good to go! Update the Credentials
-	c.Key = key
+	c.Key = creds.keys[0]
 	c.Hash = sha256.New
+	c.Data = creds
 	return nil
 }
 
-// Authenticate is decorator that implements Hawk authorization.
+// Helper function that validates the request with each of the candidate keys
+// of the node until one of them produces a valid MAC. The credentials are
+// left with the key that the request was signed with.
+func validate(auth *hawk.Auth) error {
+	err := auth.Valid()
+
+	creds, ok := auth.Credentials.Data.(*nodeCredentials)
+	if !ok {
+		return err
+	}
+
+	for _, key := range creds.keys[1:] {
+		if err != hawk.ErrInvalidMAC {
+			break
+		}
+
+		auth.Credentials.Key = key
+		err = auth.Valid()
+	}
+
+	return err
+}
+
+// Helper function that records the nonce of a valid request, returning false
+// if the nonce has already been used by the node. An error is only returned
+// if the nonce store fails. Nonces are only recorded after the MAC is
+// validated so that forged requests can't use up the nonces of a node or fill
+// the nonce store.
+func checkNonce(app *App, auth *hawk.Auth) (bool, error) {
+	if app.Nonces == nil || auth.IsBewit {
+		return true, nil
+	}
+
+	// The Hawk ID isn't covered by the MAC and a key can be used with both its
+	// key ID and the node's name, so the nonces are recorded by node name.
+	id := auth.Credentials.ID
+	if creds, ok := auth.Credentials.Data.(*nodeCredentials); ok {
+		id = creds.node.Name
+	}
+
+	return app.Nonces.Add(id, auth.Nonce, auth.Timestamp)
+}
+
+// Authenticate is decorator that implements Hawk authorization. Requests
+// signed with the name of a node are valid if they're signed with any of the
+// node's unexpired keys, and requests are rejected if their nonce has already
+// been used by the node.
 func Authenticate(app *App, inner http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -53,10 +169,28 @@ func Authenticate(app *App, inner http.Handler) http.Handler {
 
 		// If the parsing didn't fail, check to see if auth is valid.
 		if err == nil {
-			err = auth.Valid()
+			err = validate(auth)
+		}
+
+		// Then make sure that the valid request isn't being replayed. If the
+		// nonce store fails it's a server error rather than an authentication
+		// failure, and the error isn't echoed to the client.
+		if err == nil {
+			var fresh bool
+			if fresh, err = checkNonce(app, auth); err != nil {
+				app.Log.Errorf("cannot record the nonce of %q: %s", auth.Credentials.ID, err)
+				app.JSONAbort(w, http.StatusInternalServerError)
+				return
+			}
+
+			if !fresh {
+				err = hawk.ErrReplay
+			}
 		}
 
 		if err != nil {
+			app.Metrics.ObserveAuthFailure(authFailureReason(r, err))
+
 			var statusCode int
 
 			if r.Header.Get("Authorization") == "" {
@@ -81,24 +215,39 @@ func Authenticate(app *App, inner http.Handler) http.Handler {
 			return
 		}
 
+		// Store the authenticated node for the handlers down the chain, and
+		// the authorization so that the response can be signed.
+		if creds, ok := auth.Credentials.Data.(*nodeCredentials); ok {
+			context.Set(r, nodeKey, creds.node)
+		}
+		context.Set(r, hawkAuthKey, auth)
+
 		inner.ServeHTTP(w, r)
 	})
 }
 
-// UpdateKey is the key creation mechanism for the node. It combines the Node
-// name, address, and dns fields with the current time and a simple secret
-// that is loaded from the environment. This method then sets the base64
-// encoded sha256 hash of the generated string as the key on the node.
-// Note: this method does not update the database!
-func (node *Node) UpdateKey() {
-	// Generate the plaintext version of the key.
-	secret := os.Getenv("SCRIBO_SECRET")
-	rawkey := fmt.Sprintf("%s:%s:%s:%s:%s", secret, node.Name, node.Address, node.DNS, time.Now())
-
-	// Write the Hash
-	hash := sha256.New()
-	hash.Write([]byte(rawkey))
-
-	// Set the base64 encoded key on the node.
-	node.Key = base64.URLEncoding.EncodeToString(hash.Sum(nil))
+// SignResponse sets the Hawk Server-Authorization header of the response if
+// the request was authenticated by the Authenticate decorator, so that the
+// node can verify that the response came from Scribo. The header includes a
+// hash of the payload unless it is nil, and must be set before the status
+// code is written. Responses to bewit requests are not signed.
+func SignResponse(w http.ResponseWriter, r *http.Request, contentType string, payload []byte) {
+	auth, ok := context.Get(r, hawkAuthKey).(*hawk.Auth)
+	if !ok || auth.IsBewit {
+		return
+	}
+
+	// Sign a copy so that the authorization of the request isn't modified.
+	response := *auth
+	response.Hash = nil
+
+	if payload != nil {
+		// The payload hash uses the media type without its parameters.
+		mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+		hash := response.PayloadHash(mediaType)
+		hash.Write(payload)
+		response.SetHash(hash)
+	}
+
+	w.Header().Set("Server-Authorization", response.ResponseHeader(""))
 }
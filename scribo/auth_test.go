@@ -1,9 +1,13 @@
 package scribo_test
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"time"
 
 	. "github.com/bbengfort/scribo/scribo"
@@ -13,40 +17,51 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+// FailingNonces is a nonce store that is unavailable, e.g. a database outage.
+type FailingNonces struct{}
+
+// Add returns an error that includes details of the database connection.
+func (n FailingNonces) Add(id, nonce string, ts time.Time) (bool, error) {
+	return false, errors.New("dial tcp db.example.com:5432: connection refused")
+}
+
 var _ = Describe("Auth", func() {
 
 	Describe("creating HAWK shared secrets", func() {
 
-		It("should create two different keys at different times", func() {
-			node := &Node{
-				Name:    "apollo",
-				Address: "108.51.64.223",
-				DNS:     "bryant.bengfort.com",
-			}
+		It("should create two different random keys", func() {
+			keys, err := NewKeyCipher(testMasterKey)
+			Ω(err).ShouldNot(HaveOccurred())
 
-			node.UpdateKey()
-			key1 := node.Key
+			key1, _, err := keys.Generate()
+			Ω(err).ShouldNot(HaveOccurred())
 
-			time.Sleep(1)
-			node.UpdateKey()
-			Ω(key1).ShouldNot(Equal(node.Key))
+			key2, _, err := keys.Generate()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(key1).ShouldNot(Equal(key2))
 		})
 
-		It("should create a base64 encoded sha256 hash as key", func() {
-			node := &Node{
-				Name:    "apollo",
-				Address: "108.51.64.223",
-				DNS:     "bryant.bengfort.com",
-			}
+		It("should create a base64 encoded key that is stored encrypted", func() {
+			keys, err := NewKeyCipher(testMasterKey)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			key, stored, err := keys.Generate()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(key).Should(HaveLen(44))
 
-			node.UpdateKey()
-			Ω(node.Key).Should(HaveLen(44))
+			Ω(Encrypted(stored)).Should(BeTrue())
+			Ω(stored).ShouldNot(ContainSubstring(key))
+			Ω(keys.Decrypt(stored)).Should(Equal(key))
 		})
 
 	})
 
 	Describe("authentication HAWK credentials", func() {
 
+		AfterEach(func() {
+			truncateTables(tables)
+		})
+
 		It("should return a 401 error when no credentials are provided", func() {
 			request, err := http.NewRequest("GET", "http://localhost:8080/nodes", nil)
 			response := httptest.NewRecorder()
@@ -84,8 +99,7 @@ var _ = Describe("Auth", func() {
 
 		It("should return a 200 if good credentials are provided", func() {
 			app := createTestApp()
-			_, err := app.DB.Exec("INSERT INTO nodes (name, key) VALUES ($1, $2)", "spiderman", "tinglingspideysense")
-			Ω(err).ShouldNot(HaveOccurred())
+			createNode(Node{Name: "spiderman"}, "tinglingspideysense")
 
 			request, err := http.NewRequest("GET", "http://localhost:8080/nodes", nil)
 			response := httptest.NewRecorder()
@@ -108,6 +122,286 @@ var _ = Describe("Auth", func() {
 			Ω(response.Code).Should(Equal(http.StatusOK))
 		})
 
+		It("should store the authenticated node in the request context", func() {
+			app := createTestApp()
+			createNode(Node{Name: "spiderman"}, "tinglingspideysense")
+
+			var node Node
+			var ok bool
+			inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				node, ok = AuthenticatedNode(r)
+			})
+
+			request := signedRequest("GET", "http://localhost:8080/nodes", nil, "spiderman", "tinglingspideysense")
+			response := httptest.NewRecorder()
+			Authenticate(app, inner).ServeHTTP(response, request)
+
+			Ω(ok).Should(BeTrue())
+			Ω(node.Name).Should(Equal("spiderman"))
+			Ω(node.ID).Should(BeNumerically(">", 0))
+		})
+
+		It("should return a 403 error if the node's key is not encrypted", func() {
+			app := createTestApp()
+			node := Node{Name: "spiderman"}
+			_, err := node.Save(db)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = db.Exec("INSERT INTO node_keys (key_id, node_id, key) VALUES ($1, $2, $3)", "plaintext", node.ID, "tinglingspideysense")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			request := signedRequest("GET", "http://localhost:8080/nodes", nil, "spiderman", "tinglingspideysense")
+			response := httptest.NewRecorder()
+			Authenticate(app, staticHandler(200, []byte("worked!"))).ServeHTTP(response, request)
+
+			Ω(response.Code).Should(Equal(http.StatusForbidden))
+		})
+
+		It("should return a 403 error if a signed request is replayed", func() {
+			app := createTestApp()
+			app.Nonces = NewMemoryNonces(10)
+			createNode(Node{Name: "spiderman"}, "tinglingspideysense")
+
+			request := signedRequest("GET", "http://localhost:8080/nodes", nil, "spiderman", "tinglingspideysense")
+			handler := Authenticate(app, staticHandler(200, []byte("worked!")))
+
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusOK))
+
+			response = httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusForbidden))
+			Ω(response.Body.String()).Should(ContainSubstring("replayed"))
+		})
+
+		It("should return a 500 error without the cause if the nonce store fails", func() {
+			app := createTestApp()
+			app.Nonces = FailingNonces{}
+			app.Metrics = NewMetrics()
+			createNode(Node{Name: "spiderman"}, "tinglingspideysense")
+
+			request := signedRequest("GET", "http://localhost:8080/nodes", nil, "spiderman", "tinglingspideysense")
+			response := httptest.NewRecorder()
+			Authenticate(app, staticHandler(200, []byte("worked!"))).ServeHTTP(response, request)
+
+			Ω(response.Code).Should(Equal(http.StatusInternalServerError))
+			Ω(response.Body.String()).ShouldNot(ContainSubstring("db.example.com"))
+
+			buf := new(bytes.Buffer)
+			Ω(app.Metrics.Write(buf, nil)).Should(Succeed())
+			Ω(buf.String()).ShouldNot(ContainSubstring(`scribo_auth_failures_total{reason=`))
+		})
+
+	})
+
+	Describe("signing HAWK responses", func() {
+
+		AfterEach(func() {
+			truncateTables(tables)
+		})
+
+		It("should sign the responses to authenticated requests", func() {
+			createNode(Node{Name: "spiderman"}, "tinglingspideysense")
+
+			route := CreateResourceRoute(NodeCollection{}, "NodeCollection", "/nodes")
+			handler := Authenticate(app, route.Handler(app))
+
+			request, auth := signRequest(GET, "http://localhost:8080/nodes", nil, "spiderman", "tinglingspideysense")
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusOK))
+
+			header := response.Header().Get("Server-Authorization")
+			Ω(header).Should(HavePrefix("Hawk "))
+			Ω(auth.ValidResponse(header)).Should(Succeed())
+
+			hash := auth.PayloadHash("application/json")
+			hash.Write(response.Body.Bytes())
+			Ω(auth.ValidHash(hash)).Should(BeTrue())
+
+			hash = auth.PayloadHash("application/json")
+			hash.Write([]byte(`{"count":0}`))
+			Ω(auth.ValidHash(hash)).Should(BeFalse())
+		})
+
+		It("should sign error responses to authenticated requests", func() {
+			createNode(Node{Name: "spiderman", Role: RoleReadOnly}, "tinglingspideysense")
+
+			route := CreateResourceRoute(NodeCollection{}, "NodeCollection", "/nodes")
+			handler := Authenticate(app, route.Handler(app))
+
+			request, auth := signRequest(POST, "http://localhost:8080/nodes", nil, "spiderman", "tinglingspideysense")
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusForbidden))
+			Ω(auth.ValidResponse(response.Header().Get("Server-Authorization"))).Should(Succeed())
+		})
+
+		It("should sign the body of not implemented responses", func() {
+			createNode(Node{Name: "spiderman", Role: RoleAdmin}, "tinglingspideysense")
+
+			route := CreateResourceRoute(NodeCollection{}, "NodeCollection", "/nodes")
+			handler := Authenticate(app, route.Handler(app))
+
+			request, auth := signRequest(http.MethodOptions, "http://localhost:8080/nodes", nil, "spiderman", "tinglingspideysense")
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusNotImplemented))
+			Ω(auth.ValidResponse(response.Header().Get("Server-Authorization"))).Should(Succeed())
+
+			hash := auth.PayloadHash("application/json")
+			hash.Write(response.Body.Bytes())
+			Ω(auth.ValidHash(hash)).Should(BeTrue())
+		})
+
+		It("should sign the responses to authenticated requests that panic", func() {
+			createNode(Node{Name: "spiderman"}, "tinglingspideysense")
+
+			handler := Recover(app, Authenticate(app, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("with great power")
+			})))
+
+			request, auth := signRequest(GET, "http://localhost:8080/nodes", nil, "spiderman", "tinglingspideysense")
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusInternalServerError))
+			Ω(auth.ValidResponse(response.Header().Get("Server-Authorization"))).Should(Succeed())
+
+			hash := auth.PayloadHash("application/json")
+			hash.Write(response.Body.Bytes())
+			Ω(auth.ValidHash(hash)).Should(BeTrue())
+		})
+
+		It("should not sign the responses to unauthenticated requests", func() {
+			route := CreateResourceRoute(PingBatch{}, "PingBatch", "/pings/batch")
+
+			request, err := http.NewRequest(GET, "http://localhost:8080/pings/batch", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			response := httptest.NewRecorder()
+			route.Handler(app).ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+			Ω(response.Header()).ShouldNot(HaveKey("Server-Authorization"))
+		})
+
+	})
+
+	Describe("authenticating with rotated keys", func() {
+
+		var (
+			node    Node
+			handler http.Handler
+		)
+
+		BeforeEach(func() {
+			node = createNode(Node{Name: "spiderman"}, "tinglingspideysense")
+			handler = Authenticate(createTestApp(), staticHandler(200, []byte("worked!")))
+		})
+
+		AfterEach(func() {
+			truncateTables(tables)
+		})
+
+		// Helper function that returns the status code of a signed request.
+		status := func(id, key string) int {
+			request := signedRequest("GET", "http://localhost:8080/nodes", nil, id, key)
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+			return response.Code
+		}
+
+		It("should authenticate requests signed with a key ID", func() {
+			keys, err := FetchActiveNodeKeys(db, node.ID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(keys).Should(HaveLen(1))
+
+			Ω(status(keys[0].KeyID, "tinglingspideysense")).Should(Equal(http.StatusOK))
+			Ω(status(keys[0].KeyID, "wrongkey")).Should(Equal(http.StatusForbidden))
+		})
+
+		It("should accept the old and new keys during the overlap", func() {
+			old, err := FetchActiveNodeKeys(db, node.ID)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			key, plaintext, err := RotateNodeKey(db, app.Keys, node, time.Hour)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(status("spiderman", "tinglingspideysense")).Should(Equal(http.StatusOK))
+			Ω(status("spiderman", plaintext)).Should(Equal(http.StatusOK))
+			Ω(status(old[0].KeyID, "tinglingspideysense")).Should(Equal(http.StatusOK))
+			Ω(status(key.KeyID, plaintext)).Should(Equal(http.StatusOK))
+			Ω(status(key.KeyID, "tinglingspideysense")).Should(Equal(http.StatusForbidden))
+		})
+
+		It("should reject the old keys after the overlap", func() {
+			old, err := FetchActiveNodeKeys(db, node.ID)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, plaintext, err := RotateNodeKey(db, app.Keys, node, 0)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(status("spiderman", "tinglingspideysense")).Should(Equal(http.StatusForbidden))
+			Ω(status(old[0].KeyID, "tinglingspideysense")).Should(Equal(http.StatusForbidden))
+			Ω(status("spiderman", plaintext)).Should(Equal(http.StatusOK))
+		})
+
+		It("should reject a request replayed with another ID of the same key", func() {
+			app := createTestApp()
+			app.Nonces = NewMemoryNonces(10)
+			handler := Authenticate(app, staticHandler(200, []byte("worked!")))
+
+			keys, err := FetchActiveNodeKeys(db, node.ID)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			request := signedRequest("GET", "http://localhost:8080/nodes", nil, keys[0].KeyID, "tinglingspideysense")
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusOK))
+
+			// The Hawk ID isn't covered by the MAC, so it can be swapped.
+			header := request.Header.Get("Authorization")
+			replayed := strings.Replace(header, `id="`+keys[0].KeyID+`"`, `id="spiderman"`, 1)
+			Ω(replayed).ShouldNot(Equal(header))
+			request.Header.Set("Authorization", replayed)
+
+			response = httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusForbidden))
+			Ω(response.Body.String()).Should(ContainSubstring("replayed"))
+		})
+
+		It("should reject revoked keys", func() {
+			key := createNodeKey(node, "spideysenseisnumb")
+			Ω(status("spiderman", "spideysenseisnumb")).Should(Equal(http.StatusOK))
+
+			Ω(RevokeNodeKey(db, key.KeyID)).Should(Succeed())
+			Ω(status("spiderman", "spideysenseisnumb")).Should(Equal(http.StatusForbidden))
+			Ω(status(key.KeyID, "spideysenseisnumb")).Should(Equal(http.StatusForbidden))
+			Ω(status("spiderman", "tinglingspideysense")).Should(Equal(http.StatusOK))
+		})
+
 	})
 
 })
+
+// Helper function to create a Hawk signed request for the given credentials.
+func signedRequest(method, url string, body io.Reader, id, key string) *http.Request {
+	request, _ := signRequest(method, url, body, id, key)
+	return request
+}
+
+// Helper function to create a Hawk signed request for the given credentials
+// that also returns the client's authorization to validate the response.
+func signRequest(method, url string, body io.Reader, id, key string) (*http.Request, *hawk.Auth) {
+	request, err := http.NewRequest(method, url, body)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	creds := &hawk.Credentials{ID: id, Key: key, Hash: sha256.New}
+
+	request.Header.Add("Content-Type", "application/json")
+	auth := hawk.NewRequestAuth(request, creds, time.Duration(0))
+	request.Header.Add("Authorization", auth.RequestHeader())
+
+	return request, auth
+}
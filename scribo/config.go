@@ -0,0 +1,327 @@
+package scribo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings for the Scribo application and commands. Each
+// setting can be specified in a configuration file using the key in its
+// config tag, or in the environment using the variable in its env tag.
+type Config struct {
+	Port        int    `config:"port" env:"PORT"`                    // The port to run the HTTP server on
+	DatabaseURL string `config:"database_url" env:"DATABASE_URL"`    // The PostgreSQL connection URL
+	MasterKey   string `config:"master_key" env:"SCRIBO_MASTER_KEY"` // Base64 encoded key that encrypts node keys
+	Root        string `config:"root" env:"SCRIBO_ROOT"`             // Serve templates and assets from disk
+
+	ReadTimeout     time.Duration `config:"read_timeout" env:"SCRIBO_READ_TIMEOUT"`         // Max duration to read a request
+	WriteTimeout    time.Duration `config:"write_timeout" env:"SCRIBO_WRITE_TIMEOUT"`       // Max duration to write a response
+	IdleTimeout     time.Duration `config:"idle_timeout" env:"SCRIBO_IDLE_TIMEOUT"`         // Max duration to keep idle connections
+	ShutdownTimeout time.Duration `config:"shutdown_timeout" env:"SCRIBO_SHUTDOWN_TIMEOUT"` // Max duration to drain requests on exit
+
+	TLSCert      string        `config:"tls_cert" env:"SCRIBO_TLS_CERT"`           // Path to the PEM encoded TLS certificate
+	TLSKey       string        `config:"tls_key" env:"SCRIBO_TLS_KEY"`             // Path to the PEM encoded TLS private key
+	RedirectPort int           `config:"redirect_port" env:"SCRIBO_REDIRECT_PORT"` // Redirect HTTP on this port to HTTPS
+	HSTSMaxAge   time.Duration `config:"hsts_max_age" env:"SCRIBO_HSTS_MAX_AGE"`   // Max age of the HSTS header (0 to disable)
+
+	LogLevel  string `config:"log_level" env:"SCRIBO_LOG_LEVEL"`   // Minimum level of log entries to write
+	LogFormat string `config:"log_format" env:"SCRIBO_LOG_FORMAT"` // Write log entries as text or json
+	AccessLog string `config:"access_log" env:"SCRIBO_ACCESS_LOG"` // Format of requests: dev, common or combined
+
+	NonceStore     string `config:"nonce_store" env:"SCRIBO_NONCE_STORE"`           // Record Hawk nonces in memory or postgres
+	NonceCacheSize int    `config:"nonce_cache_size" env:"SCRIBO_NONCE_CACHE_SIZE"` // Max nonces to record in memory
+
+	MetricsToken string `config:"metrics_token" env:"SCRIBO_METRICS_TOKEN"` // Bearer token that enables /metrics
+}
+
+// DefaultConfig returns the configuration that is used for settings that
+// are not specified in a configuration file or the environment. The default
+// shutdown timeout leaves time to exit before Heroku kills a dyno, which
+// happens 30 seconds after it is sent a SIGTERM.
+func DefaultConfig() *Config {
+	return &Config{
+		Port:            5356,
+		ReadTimeout:     15 * time.Second,
+		WriteTimeout:    30 * time.Second,
+		IdleTimeout:     120 * time.Second,
+		ShutdownTimeout: 25 * time.Second,
+		HSTSMaxAge:      365 * 24 * time.Hour,
+		LogLevel:        "info",
+		LogFormat:       "text",
+		AccessLog:       AccessLogDev,
+		NonceStore:      NonceStoreMemory,
+		NonceCacheSize:  100000,
+	}
+}
+
+// TLS returns true if the server is configured to serve HTTPS.
+func (conf *Config) TLS() bool {
+	return conf.TLSCert != "" || conf.TLSKey != ""
+}
+
+// LoadConfig creates a configuration from the defaults, updated first by the
+// settings in a YAML or TOML configuration file (if a path is specified),
+// then by the variables in a .env file in the working directory (if one
+// exists), and finally by the variables in the environment. Command line
+// flags should be applied to the returned configuration, which must then be
+// validated before use.
+func LoadConfig(path string) (*Config, error) {
+	conf := DefaultConfig()
+
+	// Load the settings from the configuration file.
+	if path != "" {
+		settings, err := readSettings(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := conf.update(settings, "config"); err != nil {
+			return nil, fmt.Errorf("invalid configuration in %s: %s", path, err)
+		}
+	}
+
+	// Load the variables from the .env file, which may not exist.
+	env, err := readSettings(".env")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := conf.update(env, "env"); err != nil {
+		return nil, fmt.Errorf("invalid configuration in .env: %s", err)
+	}
+
+	// Load the variables from the environment.
+	env = make(map[string]string)
+	for _, name := range conf.keys("env") {
+		if val, ok := os.LookupEnv(name); ok {
+			env[name] = val
+		}
+	}
+
+	if err := conf.update(env, "env"); err != nil {
+		return nil, fmt.Errorf("invalid configuration in environment: %s", err)
+	}
+
+	return conf, nil
+}
+
+// Validate returns an error if the configuration cannot be used to run the
+// application. It should be called after all settings have been applied.
+func (conf *Config) Validate() error {
+	if conf.DatabaseURL == "" {
+		return errors.New("a database url is required (set $DATABASE_URL)")
+	}
+
+	if conf.Port < 1 || conf.Port > 65535 {
+		return fmt.Errorf("port %d is not a valid port number", conf.Port)
+	}
+
+	if conf.TLS() && (conf.TLSCert == "" || conf.TLSKey == "") {
+		return errors.New("both a TLS certificate and key are required to serve HTTPS")
+	}
+
+	if conf.RedirectPort != 0 {
+		if !conf.TLS() {
+			return errors.New("cannot redirect HTTP to HTTPS without a TLS certificate and key")
+		}
+
+		if conf.RedirectPort < 0 || conf.RedirectPort > 65535 || conf.RedirectPort == conf.Port {
+			return fmt.Errorf("redirect port %d is not a valid port number", conf.RedirectPort)
+		}
+	}
+
+	for _, timeout := range []time.Duration{conf.ReadTimeout, conf.WriteTimeout, conf.IdleTimeout, conf.ShutdownTimeout, conf.HSTSMaxAge} {
+		if timeout < 0 {
+			return fmt.Errorf("duration %s cannot be negative", timeout)
+		}
+	}
+
+	if _, err := ParseLogLevel(conf.LogLevel); err != nil {
+		return err
+	}
+
+	if conf.LogFormat != "text" && conf.LogFormat != "json" {
+		return fmt.Errorf("unknown log format %q (use text or json)", conf.LogFormat)
+	}
+
+	switch conf.AccessLog {
+	case AccessLogDev, AccessLogCommon, AccessLogCombined:
+	default:
+		return fmt.Errorf("unknown access log format %q (use dev, common or combined)", conf.AccessLog)
+	}
+
+	if conf.NonceStore != NonceStoreMemory && conf.NonceStore != NonceStorePostgres {
+		return fmt.Errorf("unknown nonce store %q (use memory or postgres)", conf.NonceStore)
+	}
+
+	if conf.NonceCacheSize < 1 {
+		return fmt.Errorf("nonce cache size %d must be positive", conf.NonceCacheSize)
+	}
+
+	if conf.MasterKey != "" {
+		if _, err := NewKeyCipher(conf.MasterKey); err != nil {
+			return err
+		}
+	}
+
+	if conf.Root != "" {
+		info, err := os.Stat(conf.Root)
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return fmt.Errorf("root %s is not a directory", conf.Root)
+		}
+	}
+
+	return nil
+}
+
+// Helper function that returns the names of the settings for the given tag.
+func (conf *Config) keys(tag string) []string {
+	var keys []string
+	fields := reflect.TypeOf(conf).Elem()
+
+	for i := 0; i < fields.NumField(); i++ {
+		if key := fields.Field(i).Tag.Get(tag); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// Durations are parsed from strings such as "30s" rather than as integers.
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Helper function that sets the fields of the configuration from a map of
+// settings whose names are specified by the tag on each field. Settings that
+// do not match a field are ignored so that other variables can share a file.
+func (conf *Config) update(settings map[string]string, tag string) error {
+	fields := reflect.TypeOf(conf).Elem()
+	values := reflect.ValueOf(conf).Elem()
+
+	for i := 0; i < fields.NumField(); i++ {
+		val, ok := settings[fields.Field(i).Tag.Get(tag)]
+		if !ok {
+			continue
+		}
+
+		field := values.Field(i)
+		switch field.Kind() {
+		case reflect.Int64:
+			if field.Type() != durationType {
+				return fmt.Errorf("unhandled configuration type %s", field.Type())
+			}
+
+			d, err := time.ParseDuration(val)
+			if err != nil {
+				return fmt.Errorf("could not parse %s: %q is not a duration", fields.Field(i).Tag.Get(tag), val)
+			}
+			field.SetInt(int64(d))
+		case reflect.String:
+			field.SetString(val)
+		case reflect.Int:
+			num, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return fmt.Errorf("could not parse %s: %q is not an integer", fields.Field(i).Tag.Get(tag), val)
+			}
+			field.SetInt(num)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("could not parse %s: %q is not a boolean", fields.Field(i).Tag.Get(tag), val)
+			}
+			field.SetBool(b)
+		default:
+			return fmt.Errorf("unhandled configuration type %s", field.Type())
+		}
+	}
+
+	return nil
+}
+
+// Helper function that reads flat key/value settings from a file. YAML files
+// (.yml or .yaml) separate keys and values with a colon, while TOML files
+// and .env files separate them with an equals sign. Nested tables, lists and
+// multi-line values are not supported.
+func readSettings(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sep := "="
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		sep = ":"
+	}
+
+	return parseSettings(f, sep)
+}
+
+// Helper function that parses flat key/value settings from a reader.
+func parseSettings(r io.Reader, sep string) (map[string]string, error) {
+	settings := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip blank lines, comments and YAML document markers.
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+
+		// Allow shell style exports in .env files.
+		line = strings.TrimPrefix(line, "export ")
+
+		parts := strings.SplitN(line, sep, 2)
+		if len(parts) != 2 || strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("line %d: expected a key %s value setting", lineno, sep)
+		}
+
+		key := strings.TrimSpace(parts[0])
+		val, err := parseValue(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineno, err)
+		}
+
+		settings[key] = val
+	}
+
+	return settings, scanner.Err()
+}
+
+// Helper function that unquotes a setting value or strips a trailing comment
+// from an unquoted value.
+func parseValue(val string) (string, error) {
+	if len(val) > 0 && (val[0] == '"' || val[0] == '\'') {
+		end := strings.LastIndexByte(val, val[0])
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", val)
+		}
+
+		if val[0] == '\'' {
+			return val[1:end], nil
+		}
+
+		return strconv.Unquote(val[:end+1])
+	}
+
+	if idx := strings.Index(val, " #"); idx >= 0 {
+		val = strings.TrimSpace(val[:idx])
+	}
+
+	return val, nil
+}
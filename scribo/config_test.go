@@ -0,0 +1,134 @@
+package scribo_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/bbengfort/scribo/scribo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+
+	var dir string
+	var environ map[string]string
+
+	// Helper to write a configuration file to the temporary directory.
+	writeConfig := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		Ω(ioutil.WriteFile(path, []byte(data), 0644)).Should(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "scribo-config")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		// Clear the configuration from the environment, restoring it after.
+		environ = make(map[string]string)
+		for _, key := range []string{"PORT", "DATABASE_URL", "SCRIBO_MASTER_KEY", "SCRIBO_ROOT", "SCRIBO_SHUTDOWN_TIMEOUT", "SCRIBO_LOG_LEVEL", "SCRIBO_LOG_FORMAT", "SCRIBO_ACCESS_LOG"} {
+			if val, ok := os.LookupEnv(key); ok {
+				environ[key] = val
+			}
+			os.Unsetenv(key)
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+		for key, val := range environ {
+			os.Setenv(key, val)
+		}
+	})
+
+	It("should use the defaults with no configuration", func() {
+		conf, err := LoadConfig("")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(conf).Should(Equal(DefaultConfig()))
+	})
+
+	It("should load settings from a YAML file", func() {
+		path := writeConfig("scribo.yml", "---\n# Scribo settings\nport: 8080\ndatabase_url: postgresql://localhost/scribo\nmaster_key: 'theeagle'\n")
+		conf, err := LoadConfig(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(conf.Port).Should(Equal(8080))
+		Ω(conf.DatabaseURL).Should(Equal("postgresql://localhost/scribo"))
+		Ω(conf.MasterKey).Should(Equal("theeagle"))
+	})
+
+	It("should load settings from a TOML file", func() {
+		path := writeConfig("scribo.toml", "port = 8080 # the web port\ndatabase_url = \"postgresql://localhost/scribo\"\n")
+		conf, err := LoadConfig(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(conf.Port).Should(Equal(8080))
+		Ω(conf.DatabaseURL).Should(Equal("postgresql://localhost/scribo"))
+	})
+
+	It("should prefer the environment to the configuration file", func() {
+		path := writeConfig("scribo.toml", "port = 8080\nmaster_key = \"theeagle\"\n")
+		os.Setenv("PORT", "9000")
+
+		conf, err := LoadConfig(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(conf.Port).Should(Equal(9000))
+		Ω(conf.MasterKey).Should(Equal("theeagle"))
+	})
+
+	It("should parse durations for the server timeouts", func() {
+		path := writeConfig("scribo.yml", "read_timeout: 5s\nidle_timeout: 2m\n")
+		os.Setenv("SCRIBO_SHUTDOWN_TIMEOUT", "500ms")
+
+		conf, err := LoadConfig(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(conf.ReadTimeout).Should(Equal(5 * time.Second))
+		Ω(conf.WriteTimeout).Should(Equal(DefaultConfig().WriteTimeout))
+		Ω(conf.IdleTimeout).Should(Equal(2 * time.Minute))
+		Ω(conf.ShutdownTimeout).Should(Equal(500 * time.Millisecond))
+
+		path = writeConfig("invalid.yml", "read_timeout: 5\n")
+		_, err = LoadConfig(path)
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should report malformed settings", func() {
+		path := writeConfig("scribo.toml", "port = eighty\n")
+		_, err := LoadConfig(path)
+		Ω(err).Should(HaveOccurred())
+
+		path = writeConfig("nested.toml", "[server]\nport = 80\n")
+		_, err = LoadConfig(path)
+		Ω(err).Should(HaveOccurred())
+
+		_, err = LoadConfig(filepath.Join(dir, "missing.yml"))
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should validate the configuration", func() {
+		conf := DefaultConfig()
+		Ω(conf.Validate()).ShouldNot(Succeed())
+
+		conf.DatabaseURL = "postgresql://localhost/scribo"
+		Ω(conf.Validate()).Should(Succeed())
+
+		conf.Port = 70000
+		Ω(conf.Validate()).ShouldNot(Succeed())
+
+		conf.Port = 8080
+		conf.ShutdownTimeout = -1 * time.Second
+		Ω(conf.Validate()).ShouldNot(Succeed())
+
+		conf.ShutdownTimeout = 0
+		conf.NonceStore = "redis"
+		Ω(conf.Validate()).ShouldNot(Succeed())
+
+		conf.NonceStore = NonceStorePostgres
+		conf.NonceCacheSize = 0
+		Ω(conf.Validate()).ShouldNot(Succeed())
+	})
+
+})
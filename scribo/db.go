@@ -2,16 +2,18 @@ package scribo
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
-	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	// Loads the driver for database/sql
 	_ "github.com/jackc/pgx/stdlib"
 )
 
 // ConnectDB establishes a connection to the PostgreSQL database
-func ConnectDB() *sql.DB {
-	dbURL := os.Getenv("DATABASE_URL")
+func ConnectDB(dbURL string) *sql.DB {
 	log.Printf("Connecting to database at %s", dbURL)
 
 	db, err := sql.Open("pgx", dbURL)
@@ -22,16 +24,20 @@ func ConnectDB() *sql.DB {
 	return db
 }
 
-// GetNode by ID, attempts to return the node or an error otherwise.
+// The columns of the nodes table in the order they are scanned into a Node.
+const nodeColumns = "id, name, address, dns, role, created, updated"
+
+// GetNode by ID, attempts to return the node or an error otherwise. If the
+// node does not exist, a NotFoundError is returned.
 func GetNode(db *sql.DB, id int64) (Node, error) {
 	var n Node
 
-	row := db.QueryRow("SELECT * FROM nodes WHERE id = $1", id)
-	err := row.Scan(&n.ID, &n.Name, &n.Address, &n.DNS, &n.Key, &n.Created, &n.Updated)
+	row := db.QueryRow("SELECT "+nodeColumns+" FROM nodes WHERE id = $1", id)
+	err := row.Scan(&n.ID, &n.Name, &n.Address, &n.DNS, &n.Role, &n.Created, &n.Updated)
 
 	switch {
 	case err == sql.ErrNoRows:
-		return Node{}, nil
+		return Node{}, &NotFoundError{Resource: "node", Key: id}
 	case err != nil:
 		return n, err
 	default:
@@ -40,15 +46,16 @@ func GetNode(db *sql.DB, id int64) (Node, error) {
 }
 
 // GetNodeByName attempts to return the node from a name or an error otherwise.
+// If the node does not exist, a NotFoundError is returned.
 func GetNodeByName(db *sql.DB, name string) (Node, error) {
 	var n Node
 
-	row := db.QueryRow("SELECT * FROM nodes WHERE name = $1", name)
-	err := row.Scan(&n.ID, &n.Name, &n.Address, &n.DNS, &n.Key, &n.Created, &n.Updated)
+	row := db.QueryRow("SELECT "+nodeColumns+" FROM nodes WHERE name = $1", name)
+	err := row.Scan(&n.ID, &n.Name, &n.Address, &n.DNS, &n.Role, &n.Created, &n.Updated)
 
 	switch {
 	case err == sql.ErrNoRows:
-		return Node{}, nil
+		return Node{}, &NotFoundError{Resource: "node", Key: name}
 	case err != nil:
 		return n, err
 	default:
@@ -81,27 +88,129 @@ func NodeExistsByName(db *sql.DB, name string) (bool, error) {
 // This function expects you to limit the size of the collection by specifying
 // the maximum number of nodes to return in the Nodes collection.
 func FetchNodes(db *sql.DB, limit int) (Nodes, error) {
+	return QueryNodes(db, NodeQuery{Limit: limit})
+}
+
+// NodeQuery describes a searchable, paginated listing of nodes. Nodes are
+// returned most recently updated first and are paginated by offset since the
+// number of nodes in a deployment is small. Zero values are ignored when
+// building the query.
+type NodeQuery struct {
+	Offset  int    // The number of matching nodes to skip
+	Limit   int    // The maximum number of nodes to return
+	Name    string // Only nodes whose name begins with this prefix
+	Address string // Only nodes with this IP address
+	DNS     string // Only nodes with this domain name
+}
+
+// Helper function that builds the WHERE clause for the filters of the query.
+func (q NodeQuery) where() *whereClause {
+	where := new(whereClause)
+
+	if q.Name != "" {
+		where.Add("name LIKE $%d", escapeLike(q.Name)+"%")
+	}
+
+	if q.Address != "" {
+		where.Add("address = $%d", q.Address)
+	}
+
+	if q.DNS != "" {
+		where.Add("dns = $%d", q.DNS)
+	}
+
+	return where
+}
+
+// QueryNodes returns the collection of nodes that match the filters in the
+// query, ordered by the updated timestamp. If no limit is specified, all
+// matching nodes are returned.
+func QueryNodes(db *sql.DB, q NodeQuery) (Nodes, error) {
 	var nodes Nodes
+	where := q.where()
 
-	rows, err := db.Query("SELECT * FROM nodes ORDER BY updated DESC LIMIT $1", limit)
+	query := "SELECT " + nodeColumns + " FROM nodes" + where.String() + " ORDER BY updated DESC, id DESC"
+	args := where.Args()
+
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	if q.Offset > 0 {
+		args = append(args, q.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nodes, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var n Node
-		if err := rows.Scan(&n.ID, &n.Name, &n.Address, &n.DNS, &n.Key, &n.Created, &n.Updated); err != nil {
+		if err := rows.Scan(&n.ID, &n.Name, &n.Address, &n.DNS, &n.Role, &n.Created, &n.Updated); err != nil {
 			return nodes, err
 		}
 
 		nodes = append(nodes, n)
 	}
 
-	rows.Close()
-	return nodes, nil
+	return nodes, rows.Err()
+}
+
+// CountNodes returns the total number of nodes that match the filters in the
+// query, ignoring the offset and limit.
+func CountNodes(db *sql.DB, q NodeQuery) (int64, error) {
+	var count int64
+	where := q.where()
+
+	row := db.QueryRow("SELECT count(*) FROM nodes"+where.String(), where.Args()...)
+	err := row.Scan(&count)
+
+	return count, err
 }
 
-// GetPing by ID, attempts to return the ping or an error otherwise.
+// FetchNodeIDs returns the set of the given IDs that belong to nodes in the
+// database, which is useful for checking the references of many pings at
+// once. Only the distinct IDs are looked up.
+func FetchNodeIDs(db *sql.DB, nodeIDs ...int64) (map[int64]bool, error) {
+	ids := make(map[int64]bool)
+	if len(nodeIDs) == 0 {
+		return ids, nil
+	}
+
+	// The IDs are passed as a Postgres array literal, e.g. {1,2,3}.
+	distinct := make(map[int64]bool)
+	elems := make([]string, 0, len(nodeIDs))
+	for _, id := range nodeIDs {
+		if !distinct[id] {
+			distinct[id] = true
+			elems = append(elems, strconv.FormatInt(id, 10))
+		}
+	}
+
+	rows, err := db.Query("SELECT id FROM nodes WHERE id = ANY($1::bigint[])", "{"+strings.Join(elems, ",")+"}")
+	if err != nil {
+		return ids, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return ids, err
+		}
+
+		ids[id] = true
+	}
+
+	return ids, rows.Err()
+}
+
+// GetPing by ID, attempts to return the ping or an error otherwise. If the
+// ping does not exist, a NotFoundError is returned.
 func GetPing(db *sql.DB, id int64) (Ping, error) {
 	var p Ping
 
@@ -110,7 +219,7 @@ func GetPing(db *sql.DB, id int64) (Ping, error) {
 
 	switch {
 	case err == sql.ErrNoRows:
-		return Ping{}, nil
+		return Ping{}, &NotFoundError{Resource: "ping", Key: id}
 	case err != nil:
 		return p, err
 	default:
@@ -133,12 +242,67 @@ func PingExists(db *sql.DB, id int64) (bool, error) {
 // This function expects you to limit the size of the collection by specifying
 // the maximum number of pings to return in the Pings collection.
 func FetchPings(db *sql.DB, limit int) (Pings, error) {
+	return QueryPings(db, PingQuery{Limit: limit})
+}
+
+// PingQuery describes a filtered, paginated listing of pings. Pings are
+// returned newest first (by ID); the After cursor restricts the listing to
+// pings whose ID is less than the cursor so that the last ID of one page can
+// be used to fetch the next. Zero values are ignored when building the query.
+type PingQuery struct {
+	After   int64     // Only pings with an ID less than this cursor
+	Limit   int       // The maximum number of pings to return
+	Source  int64     // Only pings reported by this source node
+	Target  int64     // Only pings sent to this target node
+	Timeout *bool     // Only pings that did (or did not) time out
+	From    time.Time // Only pings created at or after this time
+	To      time.Time // Only pings created before this time
+}
+
+// QueryPings returns the collection of pings that match the filters in the
+// query, ordered by descending ID. If no limit is specified, all matching
+// pings are returned, so callers should almost always set one.
+func QueryPings(db *sql.DB, q PingQuery) (Pings, error) {
 	var pings Pings
+	where := new(whereClause)
+
+	if q.After > 0 {
+		where.Add("id < $%d", q.After)
+	}
+
+	if q.Source > 0 {
+		where.Add("source_id = $%d", q.Source)
+	}
+
+	if q.Target > 0 {
+		where.Add("target_id = $%d", q.Target)
+	}
+
+	if q.Timeout != nil {
+		where.Add("timeout = $%d", *q.Timeout)
+	}
+
+	if !q.From.IsZero() {
+		where.Add("created >= $%d", q.From)
+	}
 
-	rows, err := db.Query("SELECT * FROM pings ORDER BY created DESC LIMIT $1", limit)
+	if !q.To.IsZero() {
+		where.Add("created < $%d", q.To)
+	}
+
+	query := "SELECT * FROM pings" + where.String() + " ORDER BY id DESC"
+	args := where.Args()
+
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return pings, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var p Ping
@@ -149,6 +313,43 @@ func FetchPings(db *sql.DB, limit int) (Pings, error) {
 		pings = append(pings, p)
 	}
 
-	rows.Close()
-	return pings, nil
+	return pings, rows.Err()
+}
+
+// whereClause is a helper for building a SQL WHERE clause from a variable
+// number of optional conditions while keeping track of the positional
+// arguments that PostgreSQL expects ($1, $2, etc.)
+type whereClause struct {
+	conditions []string
+	args       []interface{}
+}
+
+// Add a condition to the clause. The condition should contain a single %d
+// verb that is replaced with the position of the argument in the query.
+func (w *whereClause) Add(condition string, arg interface{}) {
+	w.args = append(w.args, arg)
+	w.conditions = append(w.conditions, fmt.Sprintf(condition, len(w.args)))
+}
+
+// Args returns the positional arguments for the conditions in the clause.
+func (w *whereClause) Args() []interface{} {
+	args := make([]interface{}, len(w.args))
+	copy(args, w.args)
+	return args
+}
+
+// String returns the WHERE clause with a leading space, or an empty string
+// if no conditions have been added to the clause.
+func (w *whereClause) String() string {
+	if len(w.conditions) == 0 {
+		return ""
+	}
+
+	return " WHERE " + strings.Join(w.conditions, " AND ")
+}
+
+// Helper function to escape the wildcard characters in a LIKE pattern.
+func escapeLike(pattern string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return replacer.Replace(pattern)
 }
@@ -3,9 +3,7 @@ package scribo_test
 import (
 	"database/sql"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/bbengfort/scribo/scribo"
@@ -26,12 +24,12 @@ var _ = Describe("Database", func() {
 		Ω(db.Ping()).Should(Succeed())
 	})
 
-	It("should have only one migration file", func() {
-		Ω(migrations).Should(HaveLen(1))
+	It("should have only six migration files", func() {
+		Ω(migrations).Should(HaveLen(6))
 	})
 
-	It("should only have two visible tables", func() {
-		Ω(tables).Should(HaveLen(2))
+	It("should only have five visible tables", func() {
+		Ω(tables).Should(HaveLen(5))
 	})
 
 	AfterEach(func() {
@@ -104,6 +102,42 @@ var _ = Describe("Database", func() {
 				Ω(exists).Should(BeFalse())
 			})
 
+			It("should return not found errors for missing nodes", func() {
+				_, err := scribo.GetNode(db, 42)
+				Ω(scribo.IsNotFound(err)).Should(BeTrue())
+
+				_, err = scribo.GetNodeByName(db, "hermes")
+				Ω(scribo.IsNotFound(err)).Should(BeTrue())
+
+				node := &scribo.Node{ID: 42, Name: "hermes"}
+				_, err = node.Save(db)
+				Ω(scribo.IsNotFound(err)).Should(BeTrue())
+
+				_, err = node.Delete(db)
+				Ω(scribo.IsNotFound(err)).Should(BeTrue())
+			})
+
+			It("should return a conflict error for duplicate names", func() {
+				_, err := (&scribo.Node{Name: "apollo"}).Save(db)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = (&scribo.Node{Name: "apollo"}).Save(db)
+				Ω(err).Should(BeAssignableToTypeOf(&scribo.ConflictError{}))
+			})
+
+			It("should return a conflict error when deleting a node with pings", func() {
+				apollo := &scribo.Node{Name: "apollo"}
+				_, err := apollo.Save(db)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				ping := &scribo.Ping{Source: apollo.ID, Target: apollo.ID}
+				_, err = ping.Save(db)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = apollo.Delete(db)
+				Ω(err).Should(BeAssignableToTypeOf(&scribo.ConflictError{}))
+			})
+
 		})
 
 		Context("when fetching a collection of nodes from the database", func() {
@@ -133,6 +167,53 @@ var _ = Describe("Database", func() {
 				Ω(collection).Should(HaveLen(2))
 			})
 
+			It("should search and paginate nodes with a total count", func() {
+				for _, name := range []string{"apollo", "apollo_2", "artemis", "athena"} {
+					node := &scribo.Node{Name: name, DNS: name + ".bengfort.com"}
+					_, err := node.Save(db)
+					Ω(err).ShouldNot(HaveOccurred())
+				}
+
+				query := scribo.NodeQuery{Name: "apollo", Limit: 1}
+				collection, err := scribo.QueryNodes(db, query)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(collection).Should(HaveLen(1))
+
+				total, err := scribo.CountNodes(db, query)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(total).Should(Equal(int64(2)))
+
+				query = scribo.NodeQuery{Name: "apollo_", Offset: 0}
+				total, err = scribo.CountNodes(db, query)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(total).Should(Equal(int64(1)))
+
+				collection, err = scribo.QueryNodes(db, scribo.NodeQuery{DNS: "athena.bengfort.com"})
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(collection).Should(HaveLen(1))
+				Ω(collection[0].Name).Should(Equal("athena"))
+
+				collection, err = scribo.QueryNodes(db, scribo.NodeQuery{Offset: 3, Limit: 10})
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(collection).Should(HaveLen(1))
+			})
+
+			It("should fetch only the given IDs of existing nodes", func() {
+				for _, name := range []string{"apollo", "artemis", "athena"} {
+					node := &scribo.Node{Name: name}
+					_, err := node.Save(db)
+					Ω(err).ShouldNot(HaveOccurred())
+				}
+
+				ids, err := scribo.FetchNodeIDs(db, 1, 3, 42, 1)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(ids).Should(Equal(map[int64]bool{1: true, 3: true}))
+
+				ids, err = scribo.FetchNodeIDs(db)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(ids).Should(BeEmpty())
+			})
+
 		})
 
 	})
@@ -153,12 +234,96 @@ var _ = Describe("Database", func() {
 				Skip("Ping database testing not implemented yet.")
 			})
 
+			It("should create a batch of pings in a single transaction", func() {
+				for _, name := range []string{"apollo", "artemis"} {
+					node := &scribo.Node{Name: name}
+					_, err := node.Save(db)
+					Ω(err).ShouldNot(HaveOccurred())
+				}
+
+				pings := scribo.Pings{
+					{Source: 1, Target: 2, Latency: 12.4},
+					{Source: 2, Target: 1, Latency: 13.1},
+					{Source: 1, Target: 2, Timeout: true},
+				}
+
+				Ω(pings.Save(db)).Should(Succeed())
+				for i, ping := range pings {
+					Ω(ping.ID).Should(Equal(int64(i + 1)))
+					Ω(ping.Created).ShouldNot(BeZero())
+				}
+
+				ping, err := scribo.GetPing(db, 2)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(ping.Latency).Should(Equal(13.1))
+			})
+
+			It("should return a validation error for unknown nodes", func() {
+				ping := &scribo.Ping{Source: 42, Target: 43}
+				_, err := ping.Save(db)
+				Ω(err).Should(BeAssignableToTypeOf(&scribo.ValidationError{}))
+				Ω(err.(*scribo.ValidationError).Field).Should(Equal("source"))
+
+				_, err = scribo.GetPing(db, 42)
+				Ω(scribo.IsNotFound(err)).Should(BeTrue())
+			})
+
 		})
 
 		Context("when fetching a collection of pings from the database", func() {
 
+			BeforeEach(func() {
+				for _, name := range []string{"apollo", "artemis"} {
+					node := &scribo.Node{Name: name}
+					_, err := node.Save(db)
+					Ω(err).ShouldNot(HaveOccurred())
+				}
+
+				for i := 0; i < 6; i++ {
+					ping := &scribo.Ping{Source: 1, Target: 2, Latency: float64(i), Timeout: i%3 == 0}
+					if i%2 == 0 {
+						ping.Source, ping.Target = 2, 1
+					}
+
+					_, err := ping.Save(db)
+					Ω(err).ShouldNot(HaveOccurred())
+				}
+			})
+
 			It("should return an ordered, limited list of pings", func() {
-				Skip("Ping database testing not implemented yet.")
+				pings, err := scribo.FetchPings(db, 4)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(pings).Should(HaveLen(4))
+				Ω(pings[0].ID).Should(Equal(int64(6)))
+				Ω(pings[3].ID).Should(Equal(int64(3)))
+			})
+
+			It("should return the pings after a cursor", func() {
+				pings, err := scribo.QueryPings(db, scribo.PingQuery{After: 3, Limit: 10})
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(pings).Should(HaveLen(2))
+				Ω(pings[0].ID).Should(Equal(int64(2)))
+			})
+
+			It("should filter pings by source, target, and timeout", func() {
+				pings, err := scribo.QueryPings(db, scribo.PingQuery{Source: 1, Target: 2})
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(pings).Should(HaveLen(3))
+
+				timeout := true
+				pings, err = scribo.QueryPings(db, scribo.PingQuery{Timeout: &timeout})
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(pings).Should(HaveLen(2))
+			})
+
+			It("should filter pings by a created time window", func() {
+				pings, err := scribo.QueryPings(db, scribo.PingQuery{From: time.Now().Add(time.Hour)})
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(pings).Should(HaveLen(0))
+
+				pings, err = scribo.QueryPings(db, scribo.PingQuery{From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)})
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(pings).Should(HaveLen(6))
 			})
 
 		})
@@ -176,26 +341,16 @@ func connectTestDB() (*sql.DB, error) {
 }
 
 // Load the schema from the migration files.
-func loadMigrations() []string {
-
-	// Create a list of files in the migrations directory
-	files, err := filepath.Glob("../migrations/[0-9][0-9][0-9][0-9]-*.sql")
-	Expect(err).NotTo(HaveOccurred(), "Could not list migration files from migrations directory!")
-
-	var queries []string
-	for _, file := range files {
-		data, err := ioutil.ReadFile(file)
-		Expect(err).NotTo(HaveOccurred(), "Could not read migration file from migrations directory!")
-		queries = append(queries, string(data))
-	}
-
-	return queries
+func loadMigrations() scribo.Migrations {
+	migrations, err := scribo.LoadMigrations(os.DirFS("../migrations"))
+	Expect(err).NotTo(HaveOccurred(), "Could not load migration files from migrations directory!")
+	return migrations
 }
 
 // Execute the migrations to the database.
-func executeMigrations(queries []string) {
-	for _, query := range queries {
-		_, err := db.Exec(query)
+func executeMigrations(migrations scribo.Migrations) {
+	for _, migration := range migrations {
+		_, err := db.Exec(migration.Up)
 		Expect(err).NotTo(HaveOccurred(), "Could not execute a migration SQL file to database!")
 	}
 }
@@ -0,0 +1,177 @@
+package scribo
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// EnrollmentTokenTTL is how long enrollment tokens are valid by default.
+const EnrollmentTokenTTL = 24 * time.Hour
+
+// Size in bytes of the random enrollment tokens.
+const enrollmentTokenSize = 32
+
+// ErrInvalidEnrollmentToken is returned when enrolling a node with a token
+// that doesn't exist, has expired, or has already been used. The reasons are
+// not distinguished so that tokens can't be probed.
+var ErrInvalidEnrollmentToken = errors.New("enrollment token is invalid, expired, or already used")
+
+// EnrollmentToken is a single-use token that an admin gives to a new node so
+// that it can enroll itself with POST /enroll and receive its credentials.
+// Only the hash of the token is stored; the token itself is only available
+// when it is created.
+type EnrollmentToken struct {
+	ID      int64      `json:"id"`              // Unique ID of the token
+	Token   string     `json:"token,omitempty"` // The token, only set when created
+	Role    string     `json:"role"`            // The role of the enrolled node
+	Created time.Time  `json:"created"`         // Datetime the token was created
+	Expires time.Time  `json:"expires"`         // Datetime the token expires
+	Used    *time.Time `json:"used"`            // Datetime the token was used, nil if not
+	NodeID  *int64     `json:"node"`            // The ID of the enrolled node, nil if not
+}
+
+// Enrollment is a request to enroll a new node with an enrollment token.
+type Enrollment struct {
+	Token   string `json:"token"`   // The enrollment token given by an admin
+	Name    string `json:"name"`    // Name/DNS of the node
+	Address string `json:"address"` // IP Address of the node
+	DNS     string `json:"dns"`     // DNS Lookup for the node
+}
+
+// Credentials are the Hawk credentials issued to an enrolled node.
+type Credentials struct {
+	Node  Node   `json:"node"`   // The enrolled node
+	KeyID string `json:"key_id"` // The Hawk ID of the key
+	Key   string `json:"key"`    // The key that the node signs its requests with
+}
+
+// CreateEnrollmentToken generates a new enrollment token for a node with the
+// role that expires after the ttl, and saves its hash to the database. The
+// role defaults to reporter and the ttl to EnrollmentTokenTTL.
+func CreateEnrollmentToken(db *sql.DB, role string, ttl time.Duration) (EnrollmentToken, error) {
+	if role == "" {
+		role = RoleReporter
+	}
+
+	if ttl == 0 {
+		ttl = EnrollmentTokenTTL
+	}
+
+	var errs ValidationErrors
+	if !ValidRole(role) {
+		errs.Add("role", fmt.Sprintf("must be one of %s", rolesList()))
+	}
+
+	if ttl < 0 {
+		errs.Add("ttl", "must be positive")
+	}
+
+	if err := errs.Err(); err != nil {
+		return EnrollmentToken{}, err
+	}
+
+	raw := make([]byte, enrollmentTokenSize)
+	if _, err := rand.Read(raw); err != nil {
+		return EnrollmentToken{}, err
+	}
+
+	token := EnrollmentToken{
+		Token:   base64.RawURLEncoding.EncodeToString(raw),
+		Role:    role,
+		Created: time.Now(),
+	}
+	token.Expires = token.Created.Add(ttl)
+
+	query := "INSERT INTO enrollment_tokens (token_hash, role, created, expires) VALUES ($1, $2, $3, $4) RETURNING id"
+	row := db.QueryRow(query, hashEnrollmentToken(token.Token), token.Role, token.Created, token.Expires)
+	if err := row.Scan(&token.ID); err != nil {
+		return EnrollmentToken{}, saveError("enrollment token", err)
+	}
+
+	return token, nil
+}
+
+// FetchEnrollmentTokens returns all of the enrollment tokens, including the
+// used and expired tokens, with the most recently created tokens first.
+func FetchEnrollmentTokens(db *sql.DB) ([]EnrollmentToken, error) {
+	rows, err := db.Query("SELECT id, role, created, expires, used, node_id FROM enrollment_tokens ORDER BY created DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []EnrollmentToken
+	for rows.Next() {
+		var t EnrollmentToken
+		if err := rows.Scan(&t.ID, &t.Role, &t.Created, &t.Expires, &t.Used, &t.NodeID); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, rows.Err()
+}
+
+// Enroll consumes the enrollment token and creates a node with the role of
+// the token and a new key in a single transaction, returning the node's
+// credentials. The token is consumed atomically, so a token can only enroll
+// one node even if it is used concurrently; if the node can't be created the
+// token is not consumed. ErrInvalidEnrollmentToken is returned if the token
+// can't be used.
+func Enroll(db *sql.DB, keys *KeyCipher, enrollment Enrollment) (Credentials, error) {
+	node := Node{Name: enrollment.Name, Address: enrollment.Address, DNS: enrollment.DNS, Role: RoleReporter}
+	if err := node.Validate(); err != nil {
+		return Credentials{}, err
+	}
+
+	txn, err := db.Begin()
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer txn.Rollback()
+
+	// Consume the token; concurrent requests with the same token wait for the
+	// row lock and then no longer match because the token has been used.
+	var tokenID int64
+	now := time.Now()
+	query := "UPDATE enrollment_tokens SET used=$1 WHERE token_hash=$2 AND used IS NULL AND expires > $1 RETURNING id, role"
+	err = txn.QueryRow(query, now, hashEnrollmentToken(enrollment.Token)).Scan(&tokenID, &node.Role)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return Credentials{}, ErrInvalidEnrollmentToken
+	case err != nil:
+		return Credentials{}, err
+	}
+
+	if err := node.insert(txn); err != nil {
+		return Credentials{}, err
+	}
+
+	if _, err := txn.Exec("UPDATE enrollment_tokens SET node_id=$1 WHERE id=$2", node.ID, tokenID); err != nil {
+		return Credentials{}, err
+	}
+
+	key, plaintext, err := insertNodeKey(txn, keys, node)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return Credentials{}, err
+	}
+
+	return Credentials{Node: node, KeyID: key.KeyID, Key: plaintext}, nil
+}
+
+// Helper function that hashes an enrollment token for storage and lookup.
+func hashEnrollmentToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
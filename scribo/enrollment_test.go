@@ -0,0 +1,115 @@
+package scribo_test
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/bbengfort/scribo/scribo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Enrollment", func() {
+
+	It("should validate the role and ttl of enrollment tokens", func() {
+		_, err := CreateEnrollmentToken(nil, "superuser", -time.Hour)
+		Ω(err).Should(HaveOccurred())
+
+		fields := err.(ValidationErrors).Fields()
+		Ω(fields).Should(HaveKey("role"))
+		Ω(fields).Should(HaveKey("ttl"))
+	})
+
+	Describe("database", func() {
+
+		var keys *KeyCipher
+
+		BeforeEach(func() {
+			var err error
+			keys, err = NewKeyCipher(testMasterKey)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			truncateTables(tables)
+		})
+
+		It("should create reporter tokens that expire after a day by default", func() {
+			token, err := CreateEnrollmentToken(db, "", 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(token.ID).Should(BeNumerically(">", 0))
+			Ω(token.Role).Should(Equal(RoleReporter))
+			Ω(token.Expires).Should(BeTemporally("==", token.Created.Add(EnrollmentTokenTTL)))
+			Ω(token.Token).Should(HaveLen(43))
+
+			other, err := CreateEnrollmentToken(db, RoleAdmin, time.Hour)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(other.Token).ShouldNot(Equal(token.Token))
+
+			tokens, err := FetchEnrollmentTokens(db)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(tokens).Should(HaveLen(2))
+			Ω(tokens[0].ID).Should(Equal(other.ID))
+			Ω(tokens[0].Token).Should(BeEmpty())
+			Ω(tokens[0].Used).Should(BeNil())
+			Ω(tokens[0].NodeID).Should(BeNil())
+		})
+
+		It("should enroll a node with the role of the token", func() {
+			token, err := CreateEnrollmentToken(db, RoleReadOnly, time.Hour)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			creds, err := Enroll(db, keys, Enrollment{Token: token.Token, Name: "hermes", DNS: "hermes.example.com"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(creds.Node.ID).Should(BeNumerically(">", 0))
+			Ω(creds.Node.Role).Should(Equal(RoleReadOnly))
+
+			node, err := GetNodeByName(db, "hermes")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.DNS).Should(Equal("hermes.example.com"))
+
+			key, err := GetNodeKey(db, creds.KeyID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(key.NodeID).Should(Equal(node.ID))
+			Ω(keys.Decrypt(key.Key)).Should(Equal(creds.Key))
+		})
+
+		It("should enroll only one node when a token is used concurrently", func() {
+			token, err := CreateEnrollmentToken(db, RoleReporter, time.Hour)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var (
+				wg       sync.WaitGroup
+				mu       sync.Mutex
+				enrolled int
+				invalid  int
+			)
+
+			for _, name := range []string{"apollo", "artemis", "hermes", "zeus"} {
+				wg.Add(1)
+				go func(name string) {
+					defer wg.Done()
+					defer GinkgoRecover()
+
+					_, err := Enroll(db, keys, Enrollment{Token: token.Token, Name: name})
+
+					mu.Lock()
+					defer mu.Unlock()
+					if err == nil {
+						enrolled++
+					} else {
+						Ω(err).Should(Equal(ErrInvalidEnrollmentToken))
+						invalid++
+					}
+				}(name)
+			}
+
+			wg.Wait()
+			Ω(enrolled).Should(Equal(1))
+			Ω(invalid).Should(Equal(3))
+		})
+
+	})
+
+})
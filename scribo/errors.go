@@ -0,0 +1,177 @@
+package scribo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx"
+)
+
+// SQLSTATE codes of the constraint violations reported by PostgreSQL.
+const (
+	pgNotNullViolation    = "23502"
+	pgForeignKeyViolation = "23503"
+	pgUniqueViolation     = "23505"
+	pgCheckViolation      = "23514"
+	pgStringTooLong       = "22001"
+)
+
+// NotFoundError is returned by the database layer when a record that was
+// looked up by its ID or name does not exist.
+type NotFoundError struct {
+	Resource string      // The type of record, e.g. node or ping
+	Key      interface{} // The ID or name used to look up the record
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s %v not found", e.Resource, e.Key)
+}
+
+// ConflictError is returned by the database layer when a change conflicts
+// with the existing records, e.g. a duplicate node name or deleting a node
+// that is referenced by pings.
+type ConflictError struct {
+	Resource string // The type of record that was being changed
+	Reason   string // Why the change conflicts with the database
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s conflict: %s", e.Resource, e.Reason)
+}
+
+// ValidationError is returned when a record cannot be saved because one of
+// its fields is invalid or refers to a record that does not exist.
+type ValidationError struct {
+	Field  string // The JSON name of the invalid field
+	Reason string // Why the field is invalid
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return e.Reason
+	}
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+}
+
+// ValidationErrors collects the errors for every invalid field of a record
+// so that they can all be reported to the client at once.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Add a validation error for the field to the collection.
+func (e *ValidationErrors) Add(field, reason string) {
+	*e = append(*e, &ValidationError{Field: field, Reason: reason})
+}
+
+// Err returns the collection as an error, or nil if there are no errors.
+func (e ValidationErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Fields returns the reason each field is invalid keyed by the field name.
+// Errors that are not associated with a field use the empty string as a key.
+func (e ValidationErrors) Fields() map[string]string {
+	fields := make(map[string]string, len(e))
+	for _, err := range e {
+		if reason, ok := fields[err.Field]; ok {
+			fields[err.Field] = reason + "; " + err.Reason
+			continue
+		}
+		fields[err.Field] = err.Reason
+	}
+	return fields
+}
+
+// Helper function that returns the field errors of a validation error or a
+// collection of validation errors, or nil if the error is not a validation
+// error.
+func validationFields(err error) map[string]string {
+	var (
+		single   *ValidationError
+		multiple ValidationErrors
+	)
+
+	switch {
+	case errors.As(err, &multiple):
+		return multiple.Fields()
+	case errors.As(err, &single):
+		return ValidationErrors{single}.Fields()
+	default:
+		return nil
+	}
+}
+
+// IsNotFound returns true if the error is a NotFoundError.
+func IsNotFound(err error) bool {
+	var target *NotFoundError
+	return errors.As(err, &target)
+}
+
+// ErrorStatus returns the HTTP status code for a typed error from the
+// database layer, or false if the error is not typed.
+func ErrorStatus(err error) (int, bool) {
+	var (
+		notFound   *NotFoundError
+		conflict   *ConflictError
+		validation *ValidationError
+		invalid    ValidationErrors
+	)
+
+	switch {
+	case errors.As(err, &notFound):
+		return http.StatusNotFound, true
+	case errors.As(err, &conflict):
+		return http.StatusConflict, true
+	case errors.As(err, &validation), errors.As(err, &invalid):
+		return StatusUnprocessableEntity, true
+	default:
+		return 0, false
+	}
+}
+
+// Helper function that converts the constraint violations reported by
+// PostgreSQL when saving a record into typed errors. Other errors are
+// returned unchanged.
+func saveError(resource string, err error) error {
+	var pgErr pgx.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	switch pgErr.Code {
+	case pgUniqueViolation:
+		return &ConflictError{Resource: resource, Reason: pgErr.Detail}
+	case pgForeignKeyViolation:
+		// Foreign keys are named fk_table_field_id, e.g. fk_pings_source_id
+		field := strings.TrimPrefix(pgErr.ConstraintName, "fk_"+pgErr.TableName+"_")
+		field = strings.TrimSuffix(field, "_id")
+		return &ValidationError{Field: field, Reason: pgErr.Detail}
+	case pgNotNullViolation, pgCheckViolation, pgStringTooLong:
+		return &ValidationError{Field: pgErr.ColumnName, Reason: pgErr.Message}
+	default:
+		return err
+	}
+}
+
+// Helper function that converts the foreign key violation reported by
+// PostgreSQL when deleting a record that is still referenced into a typed
+// error. Other errors are returned unchanged.
+func deleteError(resource string, err error) error {
+	var pgErr pgx.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation {
+		return &ConflictError{Resource: resource, Reason: pgErr.Detail}
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package scribo_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	. "github.com/bbengfort/scribo/scribo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Errors", func() {
+
+	It("should map typed errors to HTTP status codes", func() {
+		cases := map[error]int{
+			&NotFoundError{Resource: "node", Key: 42}:             http.StatusNotFound,
+			&ConflictError{Resource: "node", Reason: "duplicate"}: http.StatusConflict,
+			&ValidationError{Field: "name", Reason: "required"}:   StatusUnprocessableEntity,
+		}
+
+		for err, expected := range cases {
+			code, ok := ErrorStatus(err)
+			Ω(ok).Should(BeTrue())
+			Ω(code).Should(Equal(expected))
+
+			// Wrapped errors should also be mapped
+			code, ok = ErrorStatus(fmt.Errorf("could not save: %w", err))
+			Ω(ok).Should(BeTrue())
+			Ω(code).Should(Equal(expected))
+		}
+
+		_, ok := ErrorStatus(errors.New("connection refused"))
+		Ω(ok).Should(BeFalse())
+	})
+
+	It("should describe typed errors", func() {
+		Ω((&NotFoundError{Resource: "ping", Key: int64(7)}).Error()).Should(Equal("ping 7 not found"))
+		Ω((&ValidationError{Field: "source", Reason: "unknown node"}).Error()).Should(Equal("invalid source: unknown node"))
+		Ω(IsNotFound(&NotFoundError{})).Should(BeTrue())
+		Ω(IsNotFound(errors.New("not found"))).Should(BeFalse())
+	})
+
+	It("should collect the errors for each field", func() {
+		var errs ValidationErrors
+		Ω(errs.Err()).Should(BeNil())
+
+		errs.Add("name", "is required")
+		errs.Add("address", "is too long")
+		errs.Add("address", "must be an IP address")
+
+		Ω(errs.Err()).Should(MatchError("invalid name: is required; invalid address: is too long; invalid address: must be an IP address"))
+		Ω(errs.Fields()).Should(Equal(map[string]string{
+			"name":    "is required",
+			"address": "is too long; must be an IP address",
+		}))
+
+		code, ok := ErrorStatus(errs)
+		Ω(ok).Should(BeTrue())
+		Ω(code).Should(Equal(StatusUnprocessableEntity))
+	})
+
+})
@@ -0,0 +1,30 @@
+package scribo
+
+import (
+	"io/fs"
+	"os"
+
+	embedded "github.com/bbengfort/scribo"
+)
+
+// Names of the directories of files that are embedded in the binaries.
+const (
+	AssetsDir     = "assets"
+	MigrationsDir = "migrations"
+	TemplatesDir  = "templates"
+)
+
+// OpenFiles returns one of the directories of files that are embedded in the
+// binary. If a path on disk is specified, the files are read from that path
+// instead, which allows templates, assets, and migrations to be edited during
+// development without rebuilding the binary.
+func OpenFiles(name string, path string) (fs.FS, error) {
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+		return os.DirFS(path), nil
+	}
+
+	return fs.Sub(embedded.Files, name)
+}
@@ -0,0 +1,120 @@
+package scribo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// ReadinessTimeout limits how long the readiness checks wait for the
+// database, so that load balancers don't time out before getting a response.
+const ReadinessTimeout = 5 * time.Second
+
+// HealthCheck is the result of one of the checks made by the readiness
+// endpoint, e.g. that the database can be reached.
+type HealthCheck struct {
+	Status   string `json:"status"`             // ok or error
+	Error    string `json:"error,omitempty"`    // Why the check failed
+	Version  *int   `json:"version,omitempty"`  // The migration version of the database
+	Expected *int   `json:"expected,omitempty"` // The migration version of the binary
+}
+
+// HealthResponse is the JSON response of the health and readiness endpoints.
+type HealthResponse struct {
+	Status  string                  `json:"status"` // ok or unavailable
+	Version string                  `json:"version"`
+	Checks  map[string]*HealthCheck `json:"checks,omitempty"`
+}
+
+// Healthz reports that the process is alive without checking any of its
+// dependencies, so that a failing database doesn't cause restarts.
+func Healthz(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, HealthResponse{Status: "ok", Version: Version})
+	}
+}
+
+// Readyz reports if the app is ready to handle requests: the database must
+// respond to a ping and its migrations must be at least at the version of
+// the migrations embedded in the binary. A database that has been migrated
+// ahead of the binary is still ready, so that rolling deploys can migrate
+// the database before the old servers are replaced.
+func Readyz(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), ReadinessTimeout)
+		defer cancel()
+
+		response := HealthResponse{
+			Status:  "ok",
+			Version: Version,
+			Checks: map[string]*HealthCheck{
+				"database":   checkDatabase(ctx, app),
+				"migrations": checkMigrations(ctx, app),
+			},
+		}
+
+		status := http.StatusOK
+		for _, check := range response.Checks {
+			if check.Status != "ok" {
+				response.Status = "unavailable"
+				status = http.StatusServiceUnavailable
+			}
+		}
+
+		writeHealth(w, status, response)
+	}
+}
+
+// Helper function that checks that the database responds to a ping. The
+// readiness endpoint is public, so errors from the database, which can
+// include its host, user, and name, are logged rather than reported.
+func checkDatabase(ctx context.Context, app *App) *HealthCheck {
+	if app.DB == nil {
+		return &HealthCheck{Status: "error", Error: "no database connection"}
+	}
+
+	if err := app.DB.PingContext(ctx); err != nil {
+		app.Log.Errorf("readiness check cannot reach the database: %s", err)
+		return &HealthCheck{Status: "error", Error: "unreachable"}
+	}
+
+	return &HealthCheck{Status: "ok"}
+}
+
+// Helper function that checks the version of the migrations applied to the
+// database against the version of the migrations embedded in the binary.
+func checkMigrations(ctx context.Context, app *App) *HealthCheck {
+	expected := app.SchemaVersion
+	check := &HealthCheck{Status: "error", Expected: &expected}
+
+	if app.DB == nil {
+		check.Error = "no database connection"
+		return check
+	}
+
+	var version int
+	row := app.DB.QueryRowContext(ctx, "SELECT coalesce(max(version), 0) FROM schema_migrations")
+	if err := row.Scan(&version); err != nil {
+		app.Log.Errorf("readiness check cannot query the migration version: %s", err)
+		check.Error = "cannot query the migration version"
+		return check
+	}
+
+	check.Version = &version
+	if version < expected {
+		check.Error = "database has not been migrated to the expected version"
+		return check
+	}
+
+	check.Status = "ok"
+	return check
+}
+
+// Helper function that writes a health response that should never be cached.
+func writeHealth(w http.ResponseWriter, status int, response HealthResponse) {
+	w.Header().Set(CTKEY, CTJSON)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,65 @@
+package scribo_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "github.com/bbengfort/scribo/scribo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Health", func() {
+
+	It("should report that the process is alive", func() {
+		request, _ := http.NewRequest(GET, "/healthz", nil)
+		response := httptest.NewRecorder()
+		Healthz(&App{}).ServeHTTP(response, request)
+
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Header().Get(CTKEY)).Should(Equal(CTJSON))
+
+		var data HealthResponse
+		Ω(json.Unmarshal(response.Body.Bytes(), &data)).Should(Succeed())
+		Ω(data.Status).Should(Equal("ok"))
+		Ω(data.Version).Should(Equal(Version))
+	})
+
+	It("should not be ready if the database is unreachable", func() {
+		unreachable, err := sql.Open("pgx", "postgresql://127.0.0.1:1/scribo-test?connect_timeout=1")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer unreachable.Close()
+
+		request, _ := http.NewRequest(GET, "/readyz", nil)
+		response := httptest.NewRecorder()
+		Readyz(&App{DB: unreachable, SchemaVersion: 1}).ServeHTTP(response, request)
+
+		Ω(response.Code).Should(Equal(http.StatusServiceUnavailable))
+
+		var data HealthResponse
+		Ω(json.Unmarshal(response.Body.Bytes(), &data)).Should(Succeed())
+		Ω(data.Status).Should(Equal("unavailable"))
+		Ω(data.Checks).Should(HaveKey("database"))
+		Ω(data.Checks["database"].Status).Should(Equal("error"))
+		Ω(data.Checks["database"].Error).Should(Equal("unreachable"))
+		Ω(response.Body.String()).ShouldNot(ContainSubstring("127.0.0.1"))
+		Ω(response.Body.String()).ShouldNot(ContainSubstring("scribo-test"))
+		Ω(data.Checks["migrations"].Status).Should(Equal("error"))
+		Ω(*data.Checks["migrations"].Expected).Should(Equal(1))
+	})
+
+	It("should expect the version of the embedded migrations", func() {
+		conf := DefaultConfig()
+		conf.DatabaseURL = os.Getenv("TEST_DATABASE_URL")
+		conf.MasterKey = testMasterKey
+
+		server, err := CreateApp(conf)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(server.SchemaVersion).Should(Equal(migrations.Latest()))
+	})
+
+})
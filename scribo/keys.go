@@ -0,0 +1,195 @@
+package scribo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Size in bytes of the random keys of the nodes and of the master key.
+const (
+	NodeKeySize   = 32
+	MasterKeySize = 32
+)
+
+// Prefix of the keys that are encrypted with the master key, which allows
+// the plaintext keys of nodes registered by earlier versions to be detected
+// and the encryption to be changed in the future.
+const encryptedKeyPrefix = "v1:"
+
+// ErrPlaintextKey is returned when decrypting a node key that was stored in
+// plaintext by an earlier version of Scribo. The node must be re-keyed with
+// scribo-migrate rekey.
+var ErrPlaintextKey = errors.New("node key is not encrypted and must be re-keyed")
+
+// KeyCipher encrypts the keys of the nodes at rest with AES-256-GCM using the
+// master key. Hawk needs the plaintext key to verify the MAC of a request, so
+// the keys are encrypted rather than hashed.
+type KeyCipher struct {
+	aead cipher.AEAD
+}
+
+// NewKeyCipher creates a cipher from a base64 encoded 32 byte master key.
+func NewKeyCipher(masterKey string) (*KeyCipher, error) {
+	if masterKey == "" {
+		return nil, errors.New("a master key is required to encrypt node keys (set $SCRIBO_MASTER_KEY)")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(masterKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode master key: %s", err)
+	}
+
+	if len(key) != MasterKeySize {
+		return nil, fmt.Errorf("master key must be %d bytes, not %d", MasterKeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyCipher{aead: aead}, nil
+}
+
+// GenerateMasterKey returns a new random base64 encoded master key.
+func GenerateMasterKey() (string, error) {
+	key := make([]byte, MasterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Encrypt a plaintext node key for storage in the database.
+func (c *KeyCipher) Encrypt(key string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, []byte(key), nil)
+	return encryptedKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt a node key that was stored in the database, returning
+// ErrPlaintextKey if the key was not encrypted.
+func (c *KeyCipher) Decrypt(stored string) (string, error) {
+	if stored == "" {
+		return "", errors.New("node does not have a key")
+	}
+
+	if !Encrypted(stored) {
+		return "", ErrPlaintextKey
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedKeyPrefix))
+	if err != nil {
+		return "", fmt.Errorf("could not decode node key: %s", err)
+	}
+
+	size := c.aead.NonceSize()
+	if len(sealed) < size {
+		return "", errors.New("could not decrypt node key: too short")
+	}
+
+	key, err := c.aead.Open(nil, sealed[:size], sealed[size:], nil)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt node key: %s", err)
+	}
+
+	return string(key), nil
+}
+
+// Encrypted returns true if the stored node key is encrypted.
+func Encrypted(stored string) bool {
+	return strings.HasPrefix(stored, encryptedKeyPrefix)
+}
+
+// Generate a new random key for a node, returning the plaintext key that the
+// node uses to sign its requests and the key encrypted for storage.
+func (c *KeyCipher) Generate() (key, stored string, err error) {
+	raw := make([]byte, NodeKeySize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+
+	key = base64.URLEncoding.EncodeToString(raw)
+	if stored, err = c.Encrypt(key); err != nil {
+		return "", "", err
+	}
+
+	return key, stored, nil
+}
+
+// RekeyNodes generates new random keys for the nodes that have an unexpired
+// key stored in plaintext (or for every node if all is true) and saves them
+// encrypted with the cipher in a single transaction. The other keys of the
+// re-keyed nodes expire immediately. The plaintext keys are returned by node
+// name so that they can be given to the nodes, since the nodes can no longer
+// authenticate with their old keys.
+func RekeyNodes(db *sql.DB, keys *KeyCipher, all bool) (map[string]string, error) {
+	nodes, err := QueryNodes(db, NodeQuery{})
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := make(map[int64]bool)
+	if !all {
+		rows, err := db.Query("SELECT DISTINCT node_id FROM node_keys WHERE key NOT LIKE $1 AND (expires IS NULL OR expires > now())", encryptedKeyPrefix+"%")
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return nil, err
+			}
+			plaintext[id] = true
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	txn, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Rollback()
+
+	now := time.Now()
+	rekeyed := make(map[string]string)
+	for _, node := range nodes {
+		if !all && !plaintext[node.ID] {
+			continue
+		}
+
+		_, key, err := replaceNodeKeys(txn, keys, node, now)
+		if err != nil {
+			return nil, err
+		}
+
+		rekeyed[node.Name] = key
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+
+	return rekeyed, nil
+}
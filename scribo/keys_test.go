@@ -0,0 +1,112 @@
+package scribo_test
+
+import (
+	"encoding/base64"
+	"strings"
+
+	. "github.com/bbengfort/scribo/scribo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Keys", func() {
+
+	var keys *KeyCipher
+
+	BeforeEach(func() {
+		var err error
+		keys, err = NewKeyCipher(testMasterKey)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("should require a valid master key", func() {
+		_, err := NewKeyCipher("")
+		Ω(err).Should(HaveOccurred())
+
+		_, err = NewKeyCipher("not base64!")
+		Ω(err).Should(HaveOccurred())
+
+		_, err = NewKeyCipher(base64.StdEncoding.EncodeToString([]byte("too short")))
+		Ω(err).Should(MatchError("master key must be 32 bytes, not 9"))
+
+		masterKey, err := GenerateMasterKey()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(NewKeyCipher(masterKey)).ShouldNot(BeNil())
+	})
+
+	It("should encrypt and decrypt node keys", func() {
+		stored, err := keys.Encrypt("tinglingspideysense")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(Encrypted(stored)).Should(BeTrue())
+		Ω(stored).ShouldNot(ContainSubstring("tinglingspideysense"))
+		Ω(keys.Decrypt(stored)).Should(Equal("tinglingspideysense"))
+
+		// The same key is encrypted differently every time
+		again, err := keys.Encrypt("tinglingspideysense")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(again).ShouldNot(Equal(stored))
+	})
+
+	It("should not decrypt keys with a different master key", func() {
+		stored, err := keys.Encrypt("tinglingspideysense")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		masterKey, err := GenerateMasterKey()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		other, err := NewKeyCipher(masterKey)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = other.Decrypt(stored)
+		Ω(err).Should(HaveOccurred())
+
+		_, err = keys.Decrypt(strings.TrimSuffix(stored, "=") + "A")
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should not decrypt plaintext keys", func() {
+		Ω(Encrypted("tinglingspideysense")).Should(BeFalse())
+
+		_, err := keys.Decrypt("tinglingspideysense")
+		Ω(err).Should(Equal(ErrPlaintextKey))
+
+		_, err = keys.Decrypt("")
+		Ω(err).Should(HaveOccurred())
+	})
+
+	Describe("re-keying nodes", func() {
+
+		AfterEach(func() {
+			truncateTables(tables)
+		})
+
+		It("should re-key the nodes with plaintext keys", func() {
+			apollo := Node{Name: "apollo"}
+			_, err := apollo.Save(db)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = db.Exec("INSERT INTO node_keys (key_id, node_id, key) VALUES ($1, $2, $3)", "plaintext", apollo.ID, "apollosecretkey")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			createNode(Node{Name: "artemis"}, "artemissecretkey")
+			createNode(Node{Name: "hermes"}, "hermessecretkey")
+
+			rekeyed, err := RekeyNodes(db, keys, false)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(rekeyed).Should(HaveLen(1))
+			Ω(rekeyed).Should(HaveKey("apollo"))
+
+			active, err := FetchActiveNodeKeys(db, apollo.ID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(active).Should(HaveLen(1))
+			Ω(keys.Decrypt(active[0].Key)).Should(Equal(rekeyed["apollo"]))
+
+			rekeyed, err = RekeyNodes(db, keys, true)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(rekeyed).Should(HaveLen(3))
+		})
+
+	})
+
+})
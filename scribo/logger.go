@@ -1,18 +1,187 @@
 package scribo
 
 import (
-	"log"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httputil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
+// LogLevel is the severity of a log entry.
+type LogLevel int
+
+// Levels of log entries in order of increasing severity.
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (level LogLevel) String() string {
+	if level < LevelDebug || level > LevelError {
+		return fmt.Sprintf("level(%d)", level)
+	}
+	return levelNames[level]
+}
+
+// ParseLogLevel returns the level with the given name, e.g. "info".
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return LogLevel(level), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+// Fields are key/value pairs that add structured context to a log entry.
+type Fields map[string]interface{}
+
+// LogHandler writes log entries to an output, allowing the format and the
+// destination of the logs to be plugged into a Log.
+type LogHandler interface {
+	Handle(ts time.Time, level LogLevel, msg string, fields Fields)
+}
+
+// Log writes the entries at or above its level to a LogHandler. A nil Log
+// writes text entries at the info level to stderr.
+type Log struct {
+	Level   LogLevel
+	Handler LogHandler
+}
+
+// NewLog creates a log that writes text or JSON entries to the writer.
+func NewLog(w io.Writer, level LogLevel, format string) *Log {
+	if format == "json" {
+		return &Log{Level: level, Handler: &JSONLogHandler{Out: w}}
+	}
+	return &Log{Level: level, Handler: &TextLogHandler{Out: w}}
+}
+
+var defaultLog = NewLog(os.Stderr, LevelInfo, "text")
+
+// Entry writes a log entry with the fields if the level is enabled.
+func (l *Log) Entry(level LogLevel, msg string, fields Fields) {
+	if l == nil {
+		l = defaultLog
+	}
+
+	if level < l.Level {
+		return
+	}
+
+	l.Handler.Handle(time.Now(), level, msg, fields)
+}
+
+// Debugf writes a formatted debug message to the log.
+func (l *Log) Debugf(format string, args ...interface{}) {
+	l.Entry(LevelDebug, fmt.Sprintf(format, args...), nil)
+}
+
+// Infof writes a formatted informational message to the log.
+func (l *Log) Infof(format string, args ...interface{}) {
+	l.Entry(LevelInfo, fmt.Sprintf(format, args...), nil)
+}
+
+// Warnf writes a formatted warning message to the log.
+func (l *Log) Warnf(format string, args ...interface{}) {
+	l.Entry(LevelWarn, fmt.Sprintf(format, args...), nil)
+}
+
+// Errorf writes a formatted error message to the log.
+func (l *Log) Errorf(format string, args ...interface{}) {
+	l.Entry(LevelError, fmt.Sprintf(format, args...), nil)
+}
+
+// TextLogHandler writes each entry on a line with the time, level, and
+// message followed by the fields as key=value pairs sorted by key.
+type TextLogHandler struct {
+	Out io.Writer
+	mu  sync.Mutex
+}
+
+// Handle writes the entry to the output as a line of text.
+func (h *TextLogHandler) Handle(ts time.Time, level LogLevel, msg string, fields Fields) {
+	line := fmt.Sprintf("%s %-5s %s", ts.Format("2006/01/02 15:04:05"), strings.ToUpper(level.String()), msg)
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		line += fmt.Sprintf(" %s=%v", key, fields[key])
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintln(h.Out, line)
+}
+
+// JSONLogHandler writes each entry as a JSON object on its own line with the
+// time, level, and msg keys as well as a key for each of the fields.
+type JSONLogHandler struct {
+	Out io.Writer
+	mu  sync.Mutex
+}
+
+// Handle writes the entry to the output as a JSON object.
+func (h *JSONLogHandler) Handle(ts time.Time, level LogLevel, msg string, fields Fields) {
+	entry := make(map[string]interface{}, len(fields)+3)
+	for key, val := range fields {
+		entry[key] = val
+	}
+
+	entry["time"] = ts.Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["msg"] = msg
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data, _ = json.Marshal(map[string]string{"time": entry["time"].(string), "level": "error", "msg": err.Error()})
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.Out.Write(append(data, '\n'))
+}
+
+// Access log formats that can be selected with the access_log setting.
+const (
+	AccessLogDev      = "dev"
+	AccessLogCommon   = "common"
+	AccessLogCombined = "combined"
+)
+
 // :remote-addr - :remote-user [:date[clf]] ":method :url HTTP/:http-version" :status :res[content-length]
-const common = "%s - %s [%s] \"%s %s HTTP/%s\" %s %s"
+const common = "%s - %s [%s] \"%s %s %s\" %d %d"
+
+// common ":referrer" ":user-agent"
+const combined = common + " \"%s\" \"%s\""
 
 // :method :url :status :response-time ms - :res[content-length]
 const dev = "%s %s %d %s - %d"
 
+// RequestIDHeader is the header that identifies a request in the logs. It is
+// propagated from the request if it is set by a client or proxy, otherwise a
+// new ID is generated, and it is always returned in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// Request IDs from clients must be short and safe to write to the logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
 type loggingResponseWriter interface {
 	http.ResponseWriter
 	http.Flusher
@@ -62,29 +231,87 @@ func (l *responseLogger) Flush() {
 	}
 }
 
-// Logger is a decorator for http handlers to record requests in dev format.
+// Logger is a decorator for http handlers to record requests in the access
+// log format of the app. Every access log entry includes the request ID and
+// the name of the authenticated node (or - if the request was not signed).
 func Logger(app *App, inner http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		// Propagate or generate the request ID before handling the request
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		setRequestID(r, id)
+		w.Header().Set(RequestIDHeader, id)
+
 		lw := &responseLogger{w: w}
 		inner.ServeHTTP(lw, r)
 
-		log.Printf(dev,
-			r.Method, r.RequestURI, lw.Status(), time.Since(start), lw.Size(),
-		)
+		// Handlers that don't write a response implicitly return 200 OK
+		status := lw.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		user := "-"
+		if node, ok := AuthenticatedNode(r); ok {
+			user = node.Name
+		}
+
+		var format string
+		if app.Config != nil {
+			format = app.Config.AccessLog
+		}
+
+		var msg string
+		switch format {
+		case AccessLogCommon:
+			msg = fmt.Sprintf(common,
+				remoteHost(r), user, start.Format("02/Jan/2006:15:04:05 -0700"), r.Method, r.RequestURI, r.Proto, status, lw.Size(),
+			)
+		case AccessLogCombined:
+			msg = fmt.Sprintf(combined,
+				remoteHost(r), user, start.Format("02/Jan/2006:15:04:05 -0700"), r.Method, r.RequestURI, r.Proto, status, lw.Size(), orDash(r.Referer()), orDash(r.UserAgent()),
+			)
+		default:
+			msg = fmt.Sprintf(dev,
+				r.Method, r.RequestURI, status, time.Since(start), lw.Size(),
+			)
+		}
+
+		app.Log.Entry(LevelInfo, msg, Fields{"request_id": id, "node": user})
 	})
 }
 
+// Helper function that returns the host of the client that made the request.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Helper function that returns a dash for empty values in the access log.
+func orDash(val string) string {
+	if val == "" {
+		return "-"
+	}
+	return val
+}
+
 // Debugger is a decorator for http handlers to print out the incomming request
 func Debugger(app *App, inner http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Print the request
 		data, err := httputil.DumpRequest(r, true)
 		if err != nil {
-			log.Fatalf(err.Error())
+			app.Log.Errorf("could not dump request: %s", err)
 		} else {
-			log.Printf("%s\n", data)
+			app.Log.Debugf("%s\n", data)
 		}
 
 		// Now serve the request forward
@@ -0,0 +1,127 @@
+package scribo_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/bbengfort/scribo/scribo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Logger", func() {
+
+	var buf *bytes.Buffer
+
+	BeforeEach(func() {
+		buf = new(bytes.Buffer)
+	})
+
+	It("should parse log levels by name", func() {
+		level, err := ParseLogLevel("WARN")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(level).Should(Equal(LevelWarn))
+		Ω(level.String()).Should(Equal("warn"))
+
+		_, err = ParseLogLevel("verbose")
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should not write entries below the log level", func() {
+		log := NewLog(buf, LevelWarn, "text")
+		log.Infof("starting %d workers", 4)
+		Ω(buf.Len()).Should(BeZero())
+
+		log.Errorf("could not start %d workers", 4)
+		Ω(buf.String()).Should(ContainSubstring("ERROR could not start 4 workers"))
+	})
+
+	It("should write text entries with sorted fields", func() {
+		log := NewLog(buf, LevelDebug, "text")
+		log.Entry(LevelInfo, "hello", Fields{"node": "apollo", "request_id": "abc"})
+		Ω(buf.String()).Should(HaveSuffix("INFO  hello node=apollo request_id=abc\n"))
+	})
+
+	It("should write JSON entries with fields", func() {
+		log := NewLog(buf, LevelDebug, "json")
+		log.Entry(LevelWarn, "hello", Fields{"node": "apollo"})
+
+		var entry map[string]interface{}
+		Ω(json.Unmarshal(buf.Bytes(), &entry)).Should(Succeed())
+		Ω(entry).Should(HaveKeyWithValue("level", "warn"))
+		Ω(entry).Should(HaveKeyWithValue("msg", "hello"))
+		Ω(entry).Should(HaveKeyWithValue("node", "apollo"))
+		Ω(entry).Should(HaveKey("time"))
+	})
+
+	Describe("access log", func() {
+
+		var app *App
+
+		BeforeEach(func() {
+			app = &App{Config: DefaultConfig(), Log: NewLog(buf, LevelInfo, "json")}
+		})
+
+		It("should propagate the request ID from the client", func() {
+			var id string
+			handler := Logger(app, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				id = RequestID(r)
+			}))
+
+			request, _ := http.NewRequest(GET, "/pings", nil)
+			request.Header.Set(RequestIDHeader, "proxy-1234")
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+
+			Ω(id).Should(Equal("proxy-1234"))
+			Ω(response.Header().Get(RequestIDHeader)).Should(Equal("proxy-1234"))
+
+			var entry map[string]interface{}
+			Ω(json.Unmarshal(buf.Bytes(), &entry)).Should(Succeed())
+			Ω(entry).Should(HaveKeyWithValue("request_id", "proxy-1234"))
+			Ω(entry).Should(HaveKeyWithValue("node", "-"))
+		})
+
+		It("should replace invalid request IDs from the client", func() {
+			request, _ := http.NewRequest(GET, "/pings", nil)
+			request.Header.Set(RequestIDHeader, "bad id\nINFO forged entry")
+			response := httptest.NewRecorder()
+			Logger(app, staticHandler(http.StatusOK, nil)).ServeHTTP(response, request)
+
+			id := response.Header().Get(RequestIDHeader)
+			Ω(id).Should(HaveLen(16))
+			Ω(buf.String()).ShouldNot(ContainSubstring("forged"))
+		})
+
+		It("should write requests in the common log format", func() {
+			app.Config.AccessLog = AccessLogCommon
+			app.Log = NewLog(buf, LevelInfo, "text")
+
+			request, _ := http.NewRequest(GET, "/nodes", nil)
+			request.RemoteAddr = "10.0.0.1:41234"
+			request.RequestURI = "/nodes"
+			response := httptest.NewRecorder()
+			Logger(app, staticHandler(http.StatusNotFound, []byte("missing"))).ServeHTTP(response, request)
+
+			Ω(buf.String()).Should(MatchRegexp(`10\.0\.0\.1 - - \[.+\] "GET /nodes HTTP/1\.1" 404 7 `))
+		})
+
+		It("should write requests in the combined log format", func() {
+			app.Config.AccessLog = AccessLogCombined
+			app.Log = NewLog(buf, LevelInfo, "text")
+
+			request, _ := http.NewRequest(GET, "/nodes", nil)
+			request.RequestURI = "/nodes"
+			request.Header.Set("User-Agent", "scribo-test")
+			response := httptest.NewRecorder()
+			Logger(app, staticHandler(http.StatusOK, nil)).ServeHTTP(response, request)
+
+			Ω(buf.String()).Should(ContainSubstring(`"GET /nodes HTTP/1.1" 200 0 "-" "scribo-test"`))
+		})
+
+	})
+
+})
@@ -0,0 +1,339 @@
+package scribo
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tent/hawk-go"
+)
+
+// CTPROMETHEUS is the content type of the Prometheus text exposition format.
+const CTPROMETHEUS = "text/plain; version=0.0.4; charset=utf-8"
+
+// DurationBuckets are the upper bounds in seconds of the buckets of the
+// request duration histograms.
+var DurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics collects the counters and histograms that are exposed to
+// Prometheus at /metrics. All methods are safe for concurrent use and do
+// nothing if the Metrics is nil.
+type Metrics struct {
+	sync.Mutex
+	requests     map[requestLabels]uint64     // request counts by route, method, and code
+	durations    map[requestLabels]*histogram // request durations by route and method
+	pings        map[string]uint64            // pings ingested by source node ID
+	timeouts     map[string]uint64            // timed out pings ingested by source node ID
+	authFailures map[string]uint64            // failed Hawk authentications by reason
+}
+
+// Labels that identify the requests to a route.
+type requestLabels struct {
+	route  string
+	method string
+	code   int
+}
+
+// A cumulative histogram of observations in DurationBuckets.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewMetrics creates an empty collection of metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:     make(map[requestLabels]uint64),
+		durations:    make(map[requestLabels]*histogram),
+		pings:        make(map[string]uint64),
+		timeouts:     make(map[string]uint64),
+		authFailures: make(map[string]uint64),
+	}
+}
+
+// ObserveRequest records a request to the named route and how long it took.
+func (m *Metrics) ObserveRequest(route, method string, code int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.requests[requestLabels{route, method, code}]++
+
+	key := requestLabels{route: route, method: method}
+	hist, ok := m.durations[key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(DurationBuckets))}
+		m.durations[key] = hist
+	}
+
+	seconds := duration.Seconds()
+	for idx, bound := range DurationBuckets {
+		if seconds <= bound {
+			hist.counts[idx]++
+		}
+	}
+
+	hist.sum += seconds
+	hist.count++
+}
+
+// ObservePings records pings that were saved for the source node, which is
+// labeled by its ID.
+func (m *Metrics) ObservePings(source string, pings ...Ping) {
+	if m == nil {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	for _, ping := range pings {
+		m.pings[source]++
+		if ping.Timeout {
+			m.timeouts[source]++
+		}
+	}
+}
+
+// ObserveAuthFailure records a request that failed Hawk authentication for
+// the reason, e.g. invalid_mac.
+func (m *Metrics) ObserveAuthFailure(reason string) {
+	if m == nil {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	m.authFailures[reason]++
+}
+
+// Write the metrics to the writer in the Prometheus text format. The
+// connection pool stats of the database are included if it is not nil.
+func (m *Metrics) Write(w io.Writer, db *sql.DB) error {
+	if m == nil {
+		m = NewMetrics()
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	buf := bufio.NewWriter(w)
+
+	// Requests by route
+	writeHeader(buf, "scribo_http_requests_total", "counter", "Number of HTTP requests by route, method, and status code.")
+	keys := make([]requestLabels, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sortRequestLabels(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(buf, "scribo_http_requests_total{route=%s,method=%s,code=\"%d\"} %d\n",
+			quoteLabel(key.route), quoteLabel(key.method), key.code, m.requests[key],
+		)
+	}
+
+	writeHeader(buf, "scribo_http_request_duration_seconds", "histogram", "Duration of HTTP requests by route and method.")
+	keys = keys[:0]
+	for key := range m.durations {
+		keys = append(keys, key)
+	}
+	sortRequestLabels(keys)
+
+	for _, key := range keys {
+		hist := m.durations[key]
+		labels := fmt.Sprintf("route=%s,method=%s", quoteLabel(key.route), quoteLabel(key.method))
+		for idx, bound := range DurationBuckets {
+			fmt.Fprintf(buf, "scribo_http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, formatFloat(bound), hist.counts[idx])
+		}
+		fmt.Fprintf(buf, "scribo_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, hist.count)
+		fmt.Fprintf(buf, "scribo_http_request_duration_seconds_sum{%s} %s\n", labels, formatFloat(hist.sum))
+		fmt.Fprintf(buf, "scribo_http_request_duration_seconds_count{%s} %d\n", labels, hist.count)
+	}
+
+	// Pings by source node
+	writeHeader(buf, "scribo_pings_ingested_total", "counter", "Number of pings saved by source node.")
+	writeCounters(buf, "scribo_pings_ingested_total", "source", m.pings)
+
+	writeHeader(buf, "scribo_ping_timeouts_total", "counter", "Number of timed out pings saved by source node.")
+	writeCounters(buf, "scribo_ping_timeouts_total", "source", m.timeouts)
+
+	writeHeader(buf, "scribo_ping_timeout_ratio", "gauge", "Fraction of the pings saved by source node that timed out.")
+	for _, source := range sortedKeys(m.pings) {
+		ratio := float64(m.timeouts[source]) / float64(m.pings[source])
+		fmt.Fprintf(buf, "scribo_ping_timeout_ratio{source=%s} %s\n", quoteLabel(source), formatFloat(ratio))
+	}
+
+	// Authentication failures by reason
+	writeHeader(buf, "scribo_auth_failures_total", "counter", "Number of requests that failed Hawk authentication by reason.")
+	writeCounters(buf, "scribo_auth_failures_total", "reason", m.authFailures)
+
+	// Database connection pool
+	if db != nil {
+		stats := db.Stats()
+		pool := []struct {
+			name  string
+			kind  string
+			help  string
+			value string
+		}{
+			{"scribo_db_max_open_connections", "gauge", "Maximum number of open connections to the database.", strconv.Itoa(stats.MaxOpenConnections)},
+			{"scribo_db_open_connections", "gauge", "Number of established connections to the database.", strconv.Itoa(stats.OpenConnections)},
+			{"scribo_db_in_use_connections", "gauge", "Number of connections to the database that are in use.", strconv.Itoa(stats.InUse)},
+			{"scribo_db_idle_connections", "gauge", "Number of idle connections to the database.", strconv.Itoa(stats.Idle)},
+			{"scribo_db_wait_count_total", "counter", "Number of connections to the database that were waited for.", strconv.FormatInt(stats.WaitCount, 10)},
+			{"scribo_db_wait_duration_seconds_total", "counter", "Time spent waiting for connections to the database.", formatFloat(stats.WaitDuration.Seconds())},
+			{"scribo_db_max_idle_closed_total", "counter", "Number of connections closed due to the maximum idle connections.", strconv.FormatInt(stats.MaxIdleClosed, 10)},
+			{"scribo_db_max_idle_time_closed_total", "counter", "Number of connections closed due to the maximum idle time.", strconv.FormatInt(stats.MaxIdleTimeClosed, 10)},
+			{"scribo_db_max_lifetime_closed_total", "counter", "Number of connections closed due to the maximum connection lifetime.", strconv.FormatInt(stats.MaxLifetimeClosed, 10)},
+		}
+
+		for _, metric := range pool {
+			writeHeader(buf, metric.name, metric.kind, metric.help)
+			fmt.Fprintf(buf, "%s %s\n", metric.name, metric.value)
+		}
+	}
+
+	return buf.Flush()
+}
+
+// Instrument is a decorator for http handlers that records the status code
+// and duration of the requests to the named route in the app's metrics.
+func Instrument(app *App, route string, inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lw := &responseLogger{w: w}
+		inner.ServeHTTP(lw, r)
+
+		status := lw.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		app.Metrics.ObserveRequest(route, r.Method, status, time.Since(start))
+	})
+}
+
+// MetricsHandler exposes the app's metrics in the Prometheus text format.
+// The metrics include the names of the nodes, so they are only exposed if a
+// metrics token is configured, and the scraper must send the token as a
+// bearer token in the Authorization header.
+func MetricsHandler(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.Config == nil || app.Config.MetricsToken == "" {
+			app.JSONAbort(w, http.StatusNotFound)
+			return
+		}
+
+		expected := []byte("Bearer " + app.Config.MetricsToken)
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			app.JSONAbort(w, http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set(CTKEY, CTPROMETHEUS)
+
+		if err := app.Metrics.Write(w, app.DB); err != nil {
+			app.Log.Errorf("could not write metrics: %s", err)
+		}
+	}
+}
+
+// Helper function that classifies why a request failed Hawk authentication
+// for the auth failures metric.
+func authFailureReason(r *http.Request, err error) string {
+	var (
+		authErr   hawk.AuthError
+		formatErr hawk.AuthFormatError
+		credErr   *hawk.CredentialError
+	)
+
+	switch {
+	case r.Header.Get("Authorization") == "" || errors.Is(err, hawk.ErrNoAuth):
+		return "missing"
+	case errors.As(err, &formatErr):
+		return "malformed"
+	case errors.As(err, &credErr):
+		return strings.Replace(credErr.Type.String(), " ", "_", -1)
+	case errors.As(err, &authErr):
+		switch authErr {
+		case hawk.ErrInvalidMAC:
+			return "invalid_mac"
+		case hawk.ErrReplay:
+			return "replay"
+		case hawk.ErrTimestampSkew:
+			return "timestamp_skew"
+		case hawk.ErrBewitExpired:
+			return "bewit_expired"
+		}
+	}
+
+	return "error"
+}
+
+// Helper function that returns the label of the source node of a ping for
+// the pings ingested metric. The ID is used since the name of the node is
+// only known for signed requests, so that each node has a single series.
+func pingSource(ping Ping) string {
+	return strconv.FormatInt(ping.Source, 10)
+}
+
+// Helper function that writes the HELP and TYPE lines of a metric.
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// Helper function that writes a counter for each value of a single label.
+func writeCounters(w io.Writer, name, label string, counters map[string]uint64) {
+	for _, value := range sortedKeys(counters) {
+		fmt.Fprintf(w, "%s{%s=%s} %d\n", name, label, quoteLabel(value), counters[value])
+	}
+}
+
+// Helper function that returns the keys of the counters in sorted order.
+func sortedKeys(counters map[string]uint64) []string {
+	keys := make([]string, 0, len(counters))
+	for key := range counters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Helper function that sorts request labels so that the output is stable.
+func sortRequestLabels(keys []requestLabels) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].code < keys[j].code
+	})
+}
+
+// Helper function that quotes and escapes a label value.
+func quoteLabel(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return `"` + value + `"`
+}
+
+// Helper function that formats a sample value.
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
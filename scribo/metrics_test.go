@@ -0,0 +1,134 @@
+package scribo_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/bbengfort/scribo/scribo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+
+	var app *App
+
+	BeforeEach(func() {
+		app = &App{Config: DefaultConfig(), Metrics: NewMetrics()}
+		app.Config.MetricsToken = "scrapescrape"
+	})
+
+	// Helper function that returns the response to a request for the metrics
+	// with the authorization header.
+	scrape := func(authorization string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(GET, "/metrics", nil)
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+
+		response := httptest.NewRecorder()
+		MetricsHandler(app).ServeHTTP(response, request)
+		return response
+	}
+
+	// Helper function that returns the metrics in the Prometheus text format.
+	exposition := func() string {
+		request, _ := http.NewRequest(GET, "/metrics", nil)
+		request.Header.Set("Authorization", "Bearer scrapescrape")
+		response := httptest.NewRecorder()
+		MetricsHandler(app).ServeHTTP(response, request)
+
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Header().Get(CTKEY)).Should(Equal(CTPROMETHEUS))
+		return response.Body.String()
+	}
+
+	It("should count requests by route, method, and status code", func() {
+		handler := Instrument(app, "NodeDetail", staticHandler(http.StatusNotFound, nil))
+		for i := 0; i < 2; i++ {
+			request, _ := http.NewRequest(GET, "/nodes/42", nil)
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+		}
+
+		request, _ := http.NewRequest(DELETE, "/nodes/42", nil)
+		Instrument(app, "NodeDetail", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), request)
+
+		metrics := exposition()
+		Ω(metrics).Should(ContainSubstring("# TYPE scribo_http_requests_total counter\n"))
+		Ω(metrics).Should(ContainSubstring(`scribo_http_requests_total{route="NodeDetail",method="GET",code="404"} 2`))
+		Ω(metrics).Should(ContainSubstring(`scribo_http_requests_total{route="NodeDetail",method="DELETE",code="200"} 1`))
+	})
+
+	It("should record request durations in a histogram", func() {
+		app.Metrics.ObserveRequest("PingCollection", POST, http.StatusCreated, 30*time.Millisecond)
+		app.Metrics.ObserveRequest("PingCollection", POST, http.StatusCreated, 3*time.Second)
+
+		metrics := exposition()
+		Ω(metrics).Should(ContainSubstring(`scribo_http_request_duration_seconds_bucket{route="PingCollection",method="POST",le="0.025"} 0`))
+		Ω(metrics).Should(ContainSubstring(`scribo_http_request_duration_seconds_bucket{route="PingCollection",method="POST",le="0.05"} 1`))
+		Ω(metrics).Should(ContainSubstring(`scribo_http_request_duration_seconds_bucket{route="PingCollection",method="POST",le="5"} 2`))
+		Ω(metrics).Should(ContainSubstring(`scribo_http_request_duration_seconds_bucket{route="PingCollection",method="POST",le="+Inf"} 2`))
+		Ω(metrics).Should(ContainSubstring(`scribo_http_request_duration_seconds_sum{route="PingCollection",method="POST"} 3.03`))
+		Ω(metrics).Should(ContainSubstring(`scribo_http_request_duration_seconds_count{route="PingCollection",method="POST"} 2`))
+	})
+
+	It("should count pings and timeouts by source node", func() {
+		app.Metrics.ObservePings("1", Ping{Timeout: true}, Ping{}, Ping{}, Ping{})
+		app.Metrics.ObservePings("2", Ping{})
+
+		metrics := exposition()
+		Ω(metrics).Should(ContainSubstring(`scribo_pings_ingested_total{source="1"} 4`))
+		Ω(metrics).Should(ContainSubstring(`scribo_ping_timeouts_total{source="1"} 1`))
+		Ω(metrics).Should(ContainSubstring(`scribo_ping_timeout_ratio{source="1"} 0.25`))
+		Ω(metrics).Should(ContainSubstring(`scribo_ping_timeout_ratio{source="2"} 0`))
+	})
+
+	It("should count authentication failures by reason", func() {
+		handler := Authenticate(app, staticHandler(http.StatusOK, nil))
+
+		request, _ := http.NewRequest(GET, "/pings", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+
+		request, _ = http.NewRequest(GET, "/pings", nil)
+		request.Header.Set("Authorization", `Hawk id="apollo"`)
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+
+		metrics := exposition()
+		Ω(metrics).Should(ContainSubstring(`scribo_auth_failures_total{reason="missing"} 1`))
+		Ω(metrics).Should(ContainSubstring(`scribo_auth_failures_total{reason="malformed"} 1`))
+	})
+
+	It("should escape label values", func() {
+		app.Metrics.ObservePings("bad \"node\"\n", Ping{})
+
+		buf := new(bytes.Buffer)
+		Ω(app.Metrics.Write(buf, nil)).Should(Succeed())
+		Ω(buf.String()).Should(ContainSubstring(`scribo_pings_ingested_total{source="bad \"node\"\n"} 1`))
+	})
+
+	It("should expose empty metrics if none are collected", func() {
+		app.Metrics = nil
+		Ω(exposition()).Should(ContainSubstring("# HELP scribo_auth_failures_total"))
+	})
+
+	It("should not expose the metrics unless a token is configured", func() {
+		app.Config.MetricsToken = ""
+		Ω(scrape("").Code).Should(Equal(http.StatusNotFound))
+		Ω(scrape("Bearer ").Code).Should(Equal(http.StatusNotFound))
+	})
+
+	It("should require the metrics token as a bearer token", func() {
+		response := scrape("")
+		Ω(response.Code).Should(Equal(http.StatusUnauthorized))
+		Ω(response.Header().Get("WWW-Authenticate")).Should(Equal("Bearer"))
+		Ω(response.Body.String()).ShouldNot(ContainSubstring("scribo_"))
+
+		Ω(scrape("Bearer wrongtoken").Code).Should(Equal(http.StatusUnauthorized))
+		Ω(scrape("scrapescrape").Code).Should(Equal(http.StatusUnauthorized))
+		Ω(scrape("Bearer scrapescrape").Code).Should(Equal(http.StatusOK))
+	})
+
+})
@@ -0,0 +1,394 @@
+package scribo
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Migration files are named with a four digit version and a description,
+// e.g. 0001-initialize.sql, and are paired with an optional down script that
+// reverses the migration, e.g. 0001-initialize.down.sql.
+var migrationPattern = regexp.MustCompile(`^(\d{4})-(.+?)(\.down)?\.sql$`)
+
+// Migration is a versioned change to the database schema. The Up SQL applies
+// the change and the Down SQL (if any) reverts it. Migrations should not
+// contain BEGIN or COMMIT statements, since each migration is executed in its
+// own transaction by the Migrator.
+type Migration struct {
+	Version int    // The version number of the migration
+	Name    string // A short description of the migration
+	Up      string // The SQL that applies the migration
+	Down    string // The SQL that reverts the migration
+}
+
+// Checksum returns the hex encoded SHA-256 hash of the Up SQL, which is used
+// to detect migration files that have been edited after being applied.
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// Migrations is a collection of migrations ordered by version.
+type Migrations []Migration
+
+// Latest returns the version of the most recent migration or 0 if there are
+// no migrations in the collection.
+func (m Migrations) Latest() int {
+	if len(m) == 0 {
+		return 0
+	}
+	return m[len(m)-1].Version
+}
+
+// LoadMigrations reads the up and down migration files from a directory,
+// returning the migrations ordered by version. Use OpenFiles to load the
+// migrations that are embedded in the binary.
+func LoadMigrations(dir fs.FS) (Migrations, error) {
+	files, err := fs.Glob(dir, "[0-9][0-9][0-9][0-9]-*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[int]*Migration)
+	for _, path := range files {
+		match := migrationPattern.FindStringSubmatch(path)
+		if match == nil {
+			continue
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		data, err := fs.ReadFile(dir, path)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := index[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			index[version] = migration
+		}
+
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %04d has conflicting names %q and %q", version, migration.Name, match[2])
+		}
+
+		if match[3] != "" {
+			migration.Down = string(data)
+		} else {
+			migration.Up = string(data)
+		}
+	}
+
+	migrations := make(Migrations, 0, len(index))
+	for _, migration := range index {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %04d-%s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// MigrationStatus describes whether or not a migration has been applied to
+// the database and if its file has been modified since it was applied.
+type MigrationStatus struct {
+	Migration
+	Applied  time.Time // When the migration was applied (zero if pending)
+	Modified bool      // If the checksum of the migration has changed
+}
+
+// Migrator applies and reverts migrations to a database, recording the
+// migrations that have been applied in the schema_migrations table.
+type Migrator struct {
+	DB         *sql.DB
+	Migrations Migrations
+}
+
+// Init creates the table that tracks applied migrations if it doesn't exist.
+func (m *Migrator) Init() error {
+	query := `CREATE TABLE IF NOT EXISTS "schema_migrations"
+(
+    "version" INT NOT NULL PRIMARY KEY,
+    "name" VARCHAR(255) NOT NULL,
+    "checksum" CHAR(64) NOT NULL,
+    "applied" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+	_, err := m.DB.Exec(query)
+	return err
+}
+
+// Version returns the most recently applied migration version, or 0 if no
+// migrations have been applied to the database.
+func (m *Migrator) Version() (int, error) {
+	var version int
+	row := m.DB.QueryRow("SELECT coalesce(max(version), 0) FROM schema_migrations")
+	err := row.Scan(&version)
+	return version, err
+}
+
+// Status returns the state of every known migration in version order, as well
+// as any applied migrations that no longer have a migration file.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	var status []MigrationStatus
+
+	rows, err := m.DB.Query("SELECT version, name, checksum, applied FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type record struct {
+		name     string
+		checksum string
+		applied  time.Time
+	}
+
+	applied := make(map[int]record)
+	for rows.Next() {
+		var version int
+		var r record
+		if err := rows.Scan(&version, &r.name, &r.checksum, &r.applied); err != nil {
+			return nil, err
+		}
+		applied[version] = r
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, migration := range m.Migrations {
+		s := MigrationStatus{Migration: migration}
+		if r, ok := applied[migration.Version]; ok {
+			s.Applied = r.applied
+			s.Modified = r.checksum != migration.Checksum()
+			delete(applied, migration.Version)
+		}
+		status = append(status, s)
+	}
+
+	// Applied migrations that are unknown are reported as modified.
+	for version, r := range applied {
+		s := MigrationStatus{Migration: Migration{Version: version, Name: r.name}}
+		s.Applied = r.applied
+		s.Modified = true
+		status = append(status, s)
+	}
+
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Version < status[j].Version
+	})
+
+	return status, nil
+}
+
+// Verify returns an error if any applied migration has been edited or is
+// missing since it was applied, in which case no migrations should be run.
+func (m *Migrator) Verify() error {
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range status {
+		if s.Modified {
+			return fmt.Errorf("migration %04d-%s has been modified or removed since it was applied", s.Version, s.Name)
+		}
+	}
+
+	return nil
+}
+
+// Up applies all pending migrations in version order, returning the number of
+// migrations that were applied.
+func (m *Migrator) Up() (int, error) {
+	return m.Goto(m.Migrations.Latest())
+}
+
+// Down reverts the most recently applied migration. It returns an error if
+// the migration has no down script.
+func (m *Migrator) Down() error {
+	version, err := m.Version()
+	if err != nil {
+		return err
+	}
+
+	if version == 0 {
+		return fmt.Errorf("no migrations have been applied")
+	}
+
+	target := 0
+	for _, migration := range m.Migrations {
+		if migration.Version < version {
+			target = migration.Version
+		}
+	}
+
+	_, err = m.Goto(target)
+	return err
+}
+
+// Goto applies or reverts migrations until the database is at the specified
+// version, returning the number of migrations that were applied or reverted.
+// Each migration is executed and recorded in its own transaction, so if a
+// migration fails the database is left at the last successful version.
+func (m *Migrator) Goto(version int) (int, error) {
+	if err := m.Init(); err != nil {
+		return 0, err
+	}
+
+	if err := m.Verify(); err != nil {
+		return 0, err
+	}
+
+	if version != 0 && !m.exists(version) {
+		return 0, fmt.Errorf("no migration with version %04d", version)
+	}
+
+	current, err := m.Version()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	// Apply migrations in ascending order to move forward.
+	for _, migration := range m.Migrations {
+		if migration.Version > current && migration.Version <= version {
+			if err := m.apply(migration); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+
+	// Revert migrations in descending order to move backward.
+	for i := len(m.Migrations) - 1; i >= 0; i-- {
+		migration := m.Migrations[i]
+		if migration.Version <= current && migration.Version > version {
+			if err := m.revert(migration); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Baseline records the migrations up to and including the specified version
+// as applied without executing them, returning the number of migrations that
+// were recorded. This adopts a database whose schema was created before its
+// migrations were tracked, e.g. by the original scribo schema, so that only
+// the later migrations are applied by Up. Baseline refuses to modify a
+// database that already has applied migrations.
+func (m *Migrator) Baseline(version int) (int, error) {
+	if err := m.Init(); err != nil {
+		return 0, err
+	}
+
+	if !m.exists(version) {
+		return 0, fmt.Errorf("no migration with version %04d", version)
+	}
+
+	current, err := m.Version()
+	if err != nil {
+		return 0, err
+	}
+
+	if current != 0 {
+		return 0, fmt.Errorf("cannot baseline a database that is already at version %04d", current)
+	}
+
+	txn, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	// If the transaction was committed, this will do nothing.
+	defer txn.Rollback()
+
+	count := 0
+	query := "INSERT INTO schema_migrations (version, name, checksum, applied) VALUES ($1, $2, $3, $4)"
+	for _, migration := range m.Migrations {
+		if migration.Version > version {
+			break
+		}
+
+		if _, err := txn.Exec(query, migration.Version, migration.Name, migration.Checksum(), time.Now()); err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	return count, txn.Commit()
+}
+
+// Helper function that checks if a migration version is known.
+func (m *Migrator) exists(version int) bool {
+	for _, migration := range m.Migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function that executes the up script and records the migration.
+func (m *Migrator) apply(migration Migration) error {
+	txn, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	// If the transaction was committed, this will do nothing.
+	defer txn.Rollback()
+
+	if _, err := txn.Exec(migration.Up); err != nil {
+		return fmt.Errorf("migration %04d-%s failed: %s", migration.Version, migration.Name, err)
+	}
+
+	query := "INSERT INTO schema_migrations (version, name, checksum, applied) VALUES ($1, $2, $3, $4)"
+	if _, err := txn.Exec(query, migration.Version, migration.Name, migration.Checksum(), time.Now()); err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+// Helper function that executes the down script and removes the record.
+func (m *Migrator) revert(migration Migration) error {
+	if migration.Down == "" {
+		return fmt.Errorf("migration %04d-%s has no down script", migration.Version, migration.Name)
+	}
+
+	txn, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	// If the transaction was committed, this will do nothing.
+	defer txn.Rollback()
+
+	if _, err := txn.Exec(migration.Down); err != nil {
+		return fmt.Errorf("migration %04d-%s failed: %s", migration.Version, migration.Name, err)
+	}
+
+	if _, err := txn.Exec("DELETE FROM schema_migrations WHERE version=$1", migration.Version); err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
@@ -0,0 +1,169 @@
+package scribo_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/bbengfort/scribo/scribo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Migrate", func() {
+
+	Describe("loading migrations", func() {
+
+		It("should pair up and down scripts by version", func() {
+			migrations, err := LoadMigrations(os.DirFS("../migrations"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(migrations).ShouldNot(BeEmpty())
+
+			initial := migrations[0]
+			Ω(initial.Version).Should(Equal(1))
+			Ω(initial.Name).Should(Equal("initialize"))
+			Ω(initial.Up).Should(ContainSubstring("CREATE TABLE \"nodes\""))
+			Ω(initial.Down).Should(ContainSubstring("DROP TABLE"))
+			Ω(initial.Checksum()).Should(HaveLen(64))
+		})
+
+		It("should load the migrations embedded in the binary", func() {
+			files, err := OpenFiles(MigrationsDir, "")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			embedded, err := LoadMigrations(files)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(embedded).Should(Equal(migrations))
+		})
+
+		It("should return the latest migration version", func() {
+			migrations := Migrations{{Version: 1}, {Version: 2}, {Version: 4}}
+			Ω(migrations.Latest()).Should(Equal(4))
+			Ω(Migrations{}.Latest()).Should(BeZero())
+		})
+
+	})
+
+	Describe("migrating the database", func() {
+
+		var migrator *Migrator
+
+		BeforeEach(func() {
+			dir, err := ioutil.TempDir("", "scribo-migrations")
+			Ω(err).ShouldNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			files := map[string]string{
+				"0001-create-widgets.sql":      "CREATE TABLE widgets (id SERIAL PRIMARY KEY);",
+				"0001-create-widgets.down.sql": "DROP TABLE widgets;",
+				"0002-alter-widgets.sql":       "ALTER TABLE widgets ADD COLUMN name TEXT;",
+				"0002-alter-widgets.down.sql":  "ALTER TABLE widgets DROP COLUMN name;",
+				"0003-seed-widgets.sql":        "INSERT INTO widgets (name) VALUES ('sprocket');",
+			}
+
+			for name, sql := range files {
+				err := ioutil.WriteFile(filepath.Join(dir, name), []byte(sql), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+
+			migrations, err := LoadMigrations(os.DirFS(dir))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(migrations).Should(HaveLen(3))
+
+			migrator = &Migrator{DB: db, Migrations: migrations}
+		})
+
+		AfterEach(func() {
+			_, err := db.Exec("DROP TABLE IF EXISTS widgets, schema_migrations")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should apply pending migrations and record their versions", func() {
+			count, err := migrator.Up()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(count).Should(Equal(3))
+
+			version, err := migrator.Version()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(version).Should(Equal(3))
+
+			count, err = migrator.Up()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(count).Should(BeZero())
+		})
+
+		It("should migrate up and down to a specific version", func() {
+			count, err := migrator.Goto(2)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(count).Should(Equal(2))
+
+			Ω(migrator.Down()).Should(Succeed())
+			version, err := migrator.Version()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(version).Should(Equal(1))
+
+			status, err := migrator.Status()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(status).Should(HaveLen(3))
+			Ω(status[0].Applied.IsZero()).Should(BeFalse())
+			Ω(status[1].Applied.IsZero()).Should(BeTrue())
+		})
+
+		It("should not revert a migration without a down script", func() {
+			_, err := migrator.Up()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(migrator.Down()).ShouldNot(Succeed())
+		})
+
+		It("should baseline a database created before migrations were tracked", func() {
+			_, err := db.Exec(migrator.Migrations[0].Up)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			count, err := migrator.Baseline(1)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(count).Should(Equal(1))
+
+			status, err := migrator.Status()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(status[0].Applied.IsZero()).Should(BeFalse())
+			Ω(status[0].Modified).Should(BeFalse())
+
+			count, err = migrator.Up()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(count).Should(Equal(2))
+
+			version, err := migrator.Version()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(version).Should(Equal(3))
+		})
+
+		It("should not baseline a database with applied migrations", func() {
+			_, err := migrator.Baseline(4)
+			Ω(err).Should(HaveOccurred())
+
+			_, err = migrator.Goto(1)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = migrator.Baseline(2)
+			Ω(err).Should(HaveOccurred())
+
+			version, err := migrator.Version()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(version).Should(Equal(1))
+		})
+
+		It("should refuse to migrate if an applied migration was edited", func() {
+			_, err := migrator.Goto(1)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			migrator.Migrations[0].Up = "CREATE TABLE gadgets (id SERIAL PRIMARY KEY);"
+			Ω(migrator.Verify()).ShouldNot(Succeed())
+
+			_, err = migrator.Up()
+			Ω(err).Should(HaveOccurred())
+		})
+
+	})
+
+})
@@ -3,6 +3,10 @@ package scribo
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
 	"time"
 )
 
@@ -12,7 +16,7 @@ type Node struct {
 	Name    string    `json:"name"`    // Name/DNS of the node
 	Address string    `json:"address"` // IP Address of the node
 	DNS     string    `json:"dns"`     // DNS Lookup for the node
-	Key     string    `json:"-"`       // Authentication key of the node
+	Role    string    `json:"role"`    // Permissions of the node, e.g. reporter
 	Created time.Time `json:"created"` // Datetime the node was created
 	Updated time.Time `json:"updated"` // Datetime the node was updated
 }
@@ -37,49 +41,111 @@ type Pings []Ping
 
 // Dashboard is a collection of nodes and pings for display.
 type Dashboard struct {
-	Nodes Nodes // A limited, ordered collection of nodes for display
-	Pings Pings // A limited, ordered collection of pings for display
+	Nodes  Nodes         // A limited, ordered collection of nodes for display
+	Pings  Pings         // A limited, ordered collection of pings for display
+	Matrix LatencyMatrix // The latency between all nodes over the last day
+	Series LatencySeries // The hourly latency of all pings over the last day
+}
+
+// Maximum lengths of the node fields, as defined by the database schema.
+const (
+	maxNameLength    = 255
+	maxAddressLength = 45
+	maxDNSLength     = 255
+)
+
+// Validate returns ValidationErrors describing every invalid field of the
+// node, or nil if the node can be saved to the database.
+func (node *Node) Validate() error {
+	var errs ValidationErrors
+
+	switch {
+	case strings.TrimSpace(node.Name) == "":
+		errs.Add("name", "is required")
+	case len(node.Name) > maxNameLength:
+		errs.Add("name", fmt.Sprintf("cannot be longer than %d characters", maxNameLength))
+	}
+
+	switch {
+	case len(node.Address) > maxAddressLength:
+		errs.Add("address", fmt.Sprintf("cannot be longer than %d characters", maxAddressLength))
+	case node.Address != "" && net.ParseIP(node.Address) == nil:
+		errs.Add("address", "must be an IPv4 or IPv6 address")
+	}
+
+	if len(node.DNS) > maxDNSLength {
+		errs.Add("dns", fmt.Sprintf("cannot be longer than %d characters", maxDNSLength))
+	}
+
+	if !ValidRole(node.Role) {
+		errs.Add("role", fmt.Sprintf("must be one of %s", rolesList()))
+	}
+
+	return errs.Err()
 }
 
 // Save a node struct to the database. This function checks if the node has an
 // ID or not. If it does, it will execute a SQL UPDATE, otherwise it will
 // execute a SQL INSERT. Returns a boolean if the node was created (INSERT) or
 // False if the node was simply updated in the normal manner. This method also
-// handles setting the Created and Updated timestamps on the node.
+// handles setting the Created and Updated timestamps on the node. The node is
+// validated before it is saved, and constraint violations are returned as a
+// ConflictError or ValidationError. New nodes are reporters by default.
 // TODO: Transform this into a prepared statement that we can run.
 func (node *Node) Save(db *sql.DB) (bool, error) {
+	if node.ID == 0 && node.Role == "" {
+		node.Role = RoleReporter
+	}
+
+	if err := node.Validate(); err != nil {
+		return false, err
+	}
+
 	if node.ID > 0 {
 		// This is the UPDATE method, so return false.
 		// Update the updated timestamp on the Node.
 		node.Updated = time.Now()
 
 		// Execute the query against the database
-		query := "UPDATE nodes SET name=$1, address=$2, dns=$3, key=$4, updated=$5 WHERE id = $6"
-		_, err := db.Exec(query, node.Name, node.Address, node.DNS, node.Key, node.Updated, node.ID)
+		query := "UPDATE nodes SET name=$1, address=$2, dns=$3, role=$4, updated=$5 WHERE id = $6"
+		res, err := db.Exec(query, node.Name, node.Address, node.DNS, node.Role, node.Updated, node.ID)
+		if err != nil {
+			return false, saveError("node", err)
+		}
 
-		return false, err
+		return false, updated(res, "node", node.ID)
 
 	}
 
 	// This is the INSERT method, so return true.
-	// Set the Created and Updated timestamps on the Node.
+	if err := node.insert(db); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Helper function that inserts a validated node with either a database or a
+// transaction, setting the Created and Updated timestamps on the Node.
+func (node *Node) insert(db execer) error {
 	node.Created = time.Now()
 	node.Updated = time.Now()
 
 	// Execute the INSERT query against the database
-	query := "INSERT INTO nodes (name, address, dns, key, created, updated) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
-	row := db.QueryRow(query, node.Name, node.Address, node.DNS, node.Key, node.Created, node.Updated)
-	err := row.Scan(&node.ID)
+	query := "INSERT INTO nodes (name, address, dns, role, created, updated) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+	row := db.QueryRow(query, node.Name, node.Address, node.DNS, node.Role, node.Created, node.Updated)
 
-	if err != nil {
-		return false, err
+	if err := row.Scan(&node.ID); err != nil {
+		return saveError("node", err)
 	}
 
-	return true, err
+	return nil
 }
 
 // Delete a node from the database. This method is obviously destructive and
-// returns true if the number of rows affected is 1 or false otherwise.
+// returns true if the number of rows affected is 1 or false otherwise. If the
+// node does not exist a NotFoundError is returned, and if it is referenced by
+// pings a ConflictError is returned.
 func (node *Node) Delete(db *sql.DB) (bool, error) {
 	if node.ID == 0 {
 		return false, errors.New("The node doesn't have an ID accessible by the database")
@@ -89,7 +155,7 @@ func (node *Node) Delete(db *sql.DB) (bool, error) {
 	res, err := db.Exec(query, node.ID)
 
 	if err != nil {
-		return false, err
+		return false, deleteError("node", err)
 	}
 
 	rows, err := res.RowsAffected()
@@ -102,20 +168,55 @@ func (node *Node) Delete(db *sql.DB) (bool, error) {
 	case rows == 1:
 		return true, nil
 	case rows < 1:
-		return false, nil
+		return false, &NotFoundError{Resource: "node", Key: node.ID}
 	default:
 		return false, errors.New("Unknown case in node deletion")
 	}
 
 }
 
+// Validate returns ValidationErrors describing every invalid field of the
+// ping, or nil if the ping can be saved to the database. Validate does not
+// check that the source and target nodes exist, which is enforced by the
+// database when the ping is saved.
+func (ping *Ping) Validate() error {
+	var errs ValidationErrors
+
+	if ping.Source <= 0 {
+		errs.Add("source", "is required")
+	}
+
+	if ping.Target <= 0 {
+		errs.Add("target", "is required")
+	}
+
+	if ping.Payload < 0 {
+		errs.Add("payload", "cannot be negative")
+	}
+
+	switch {
+	case math.IsNaN(ping.Latency) || math.IsInf(ping.Latency, 0):
+		errs.Add("latency", "must be a finite number")
+	case ping.Latency < 0:
+		errs.Add("latency", "cannot be negative")
+	}
+
+	return errs.Err()
+}
+
 // Save a ping struct to the database. This function checks if the ping has an
 // ID or not. If it does, it will execute a SQL UPDATE, otherwise it will
 // execute a SQL INSERT. Returns a boolean if the ping was created (INSERT) or
 // False if the ping was simply updated in the normal manner. This method also
-// handles setting the Created and Updated timestamps on the ping.
+// handles setting the Created and Updated timestamps on the ping. The ping is
+// validated before it is saved, and constraint violations are returned as a
+// ConflictError or ValidationError.
 // TODO: Transform this into a prepared statement that we can run.
 func (ping *Ping) Save(db *sql.DB) (bool, error) {
+	if err := ping.Validate(); err != nil {
+		return false, err
+	}
+
 	if ping.ID > 0 {
 		// This is the UPDATE method, so return false.
 		// Update the updated timestamp on the Node.
@@ -123,9 +224,12 @@ func (ping *Ping) Save(db *sql.DB) (bool, error) {
 
 		// Execute the query against the database
 		query := "UPDATE pings SET source_id=$1, target_id=$2, payload=$3, latency=$4, timeout=$5, updated=$6 WHERE id = $7"
-		_, err := db.Exec(query, ping.Source, ping.Target, ping.Payload, ping.Latency, ping.Timeout, ping.Updated, ping.ID)
+		res, err := db.Exec(query, ping.Source, ping.Target, ping.Payload, ping.Latency, ping.Timeout, ping.Updated, ping.ID)
+		if err != nil {
+			return false, saveError("ping", err)
+		}
 
-		return false, err
+		return false, updated(res, "ping", ping.ID)
 
 	}
 
@@ -140,14 +244,15 @@ func (ping *Ping) Save(db *sql.DB) (bool, error) {
 	err := row.Scan(&ping.ID)
 
 	if err != nil {
-		return false, err
+		return false, saveError("ping", err)
 	}
 
 	return true, err
 }
 
 // Delete a ping from the database. This method is obviously destructive and
-// returns true if the number of rows affected is 1 or false otherwise.
+// returns true if the number of rows affected is 1 or false otherwise. If the
+// ping does not exist a NotFoundError is returned.
 func (ping *Ping) Delete(db *sql.DB) (bool, error) {
 	if ping.ID == 0 {
 		return false, errors.New("The ping doesn't have an ID accessible by the database")
@@ -157,7 +262,7 @@ func (ping *Ping) Delete(db *sql.DB) (bool, error) {
 	res, err := db.Exec(query, ping.ID)
 
 	if err != nil {
-		return false, err
+		return false, deleteError("ping", err)
 	}
 
 	rows, err := res.RowsAffected()
@@ -170,9 +275,109 @@ func (ping *Ping) Delete(db *sql.DB) (bool, error) {
 	case rows == 1:
 		return true, nil
 	case rows < 1:
-		return false, nil
+		return false, &NotFoundError{Resource: "ping", Key: ping.ID}
 	default:
 		return false, errors.New("Unknown case in ping deletion")
 	}
 
 }
+
+// Helper function that returns a NotFoundError if an UPDATE did not affect
+// any rows because the record had been deleted.
+func updated(res sql.Result, resource string, id int64) error {
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return &NotFoundError{Resource: resource, Key: id}
+	}
+
+	return nil
+}
+
+// Maximum number of rows inserted by a single statement when saving a batch
+// of pings; this keeps the number of query arguments well below the limit
+// that PostgreSQL imposes on a single statement.
+const batchInsertSize = 1000
+
+// Save a collection of new pings to the database in a single transaction
+// using multi-row INSERT statements. The ID, Created and Updated fields of
+// each ping in the collection are set when the transaction commits. Pings
+// that already have an ID or are invalid cannot be saved as part of a batch.
+func (pings Pings) Save(db *sql.DB) error {
+	now := time.Now()
+
+	for idx, ping := range pings {
+		if ping.ID > 0 {
+			return errors.New("Cannot batch save a ping that already has an ID")
+		}
+
+		if err := ping.Validate(); err != nil {
+			return fmt.Errorf("ping %d in the batch is invalid: %w", idx, err)
+		}
+	}
+
+	txn, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// If the transaction was committed, this will do nothing.
+	defer txn.Rollback()
+
+	ids := make([]int64, 0, len(pings))
+	for start := 0; start < len(pings); start += batchInsertSize {
+		end := start + batchInsertSize
+		if end > len(pings) {
+			end = len(pings)
+		}
+
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*7)
+
+		for _, ping := range pings[start:end] {
+			n := len(args)
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7))
+			args = append(args, ping.Source, ping.Target, ping.Payload, ping.Latency, ping.Timeout, now, now)
+		}
+
+		query := "INSERT INTO pings (source_id, target_id, payload, latency, timeout, created, updated) VALUES " + strings.Join(values, ", ") + " RETURNING id"
+		rows, err := txn.Query(query, args...)
+		if err != nil {
+			return saveError("ping", err)
+		}
+
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return saveError("ping", err)
+		}
+	}
+
+	if len(ids) != len(pings) {
+		return fmt.Errorf("Inserted %d pings from a batch of %d", len(ids), len(pings))
+	}
+
+	if err := txn.Commit(); err != nil {
+		return saveError("ping", err)
+	}
+
+	// Only update the pings once the batch has been committed.
+	for i := range pings {
+		pings[i].ID = ids[i]
+		pings[i].Created = now
+		pings[i].Updated = now
+	}
+
+	return nil
+}
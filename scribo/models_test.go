@@ -2,6 +2,8 @@ package scribo_test
 
 import (
 	"encoding/json"
+	"math"
+	"strings"
 	"time"
 
 	. "github.com/bbengfort/scribo/scribo"
@@ -16,19 +18,17 @@ var _ = Describe("Models", func() {
 
 	Describe("Nodes", func() {
 
-		It("should not serialize the Key field", func() {
+		It("should not serialize the Key field of a node key", func() {
 
-			node := Node{
+			key := NodeKey{
 				ID:      1,
-				Name:    "apollo",
-				Address: "108.51.64.223",
-				DNS:     "bryant.bengfort.com",
+				KeyID:   "0123456789abcdef",
+				NodeID:  1,
 				Key:     "werxhqb98rpaxn39848xrunpaw3489ruxnpa98w4rxn",
 				Created: time.Now(),
-				Updated: time.Now(),
 			}
 
-			data, err := json.Marshal(node)
+			data, err := json.Marshal(key)
 			Ω(err).Should(BeNil())
 
 			var obj map[string]*json.RawMessage
@@ -40,6 +40,47 @@ var _ = Describe("Models", func() {
 			Ω(obj).ShouldNot(HaveKey("KEY"))
 		})
 
+		It("should validate the node fields", func() {
+			node := Node{Name: "apollo", Address: "108.51.64.223", DNS: "bryant.bengfort.com", Role: RoleReporter}
+			Ω(node.Validate()).Should(Succeed())
+
+			node.Address = "2001:db8::1"
+			Ω(node.Validate()).Should(Succeed())
+
+			node = Node{Address: strings.Repeat("1", 300), DNS: strings.Repeat("a", 256), Role: RoleReporter}
+			err := node.Validate()
+			Ω(err).Should(HaveOccurred())
+			Ω(err.(ValidationErrors).Fields()).Should(HaveLen(3))
+			Ω(err.(ValidationErrors).Fields()).Should(HaveKeyWithValue("name", "is required"))
+
+			node = Node{Name: "apollo", Role: "superuser"}
+			Ω(node.Validate()).Should(MatchError("invalid role: must be one of admin, reporter, read-only"))
+
+			node = Node{Name: "apollo", Address: "not an ip", Role: RoleAdmin}
+			Ω(node.Validate()).Should(MatchError("invalid address: must be an IPv4 or IPv6 address"))
+		})
+
+	})
+
+	Describe("Pings", func() {
+
+		It("should validate the ping fields", func() {
+			ping := Ping{Source: 1, Target: 2, Payload: 64, Latency: 12.3}
+			Ω(ping.Validate()).Should(Succeed())
+
+			ping = Ping{Payload: -1, Latency: -12.3}
+			err := ping.Validate()
+			Ω(err).Should(HaveOccurred())
+
+			fields := err.(ValidationErrors).Fields()
+			Ω(fields).Should(HaveLen(4))
+			Ω(fields).Should(HaveKeyWithValue("source", "is required"))
+			Ω(fields).Should(HaveKeyWithValue("latency", "cannot be negative"))
+
+			ping = Ping{Source: 1, Target: 2, Latency: math.NaN()}
+			Ω(ping.Validate()).Should(MatchError("invalid latency: must be a finite number"))
+		})
+
 	})
 
 })
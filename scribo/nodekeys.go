@@ -0,0 +1,246 @@
+package scribo
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"time"
+)
+
+// Size in bytes of the random Hawk key IDs, which are hex encoded.
+const keyIDSize = 8
+
+// NodeKey is a key that a node signs its requests with. Nodes can have more
+// than one key so that keys can be rotated without breaking the clients that
+// still use the old key: the old key remains valid until it expires. Clients
+// can sign their requests with the key ID as the Hawk ID, or with the name of
+// the node, in which case every unexpired key of the node is tried.
+type NodeKey struct {
+	ID      int64      `json:"id"`                // Unique ID of the key
+	KeyID   string     `json:"key_id"`            // The Hawk ID of the key
+	NodeID  int64      `json:"node"`              // The ID of the node
+	Key     string     `json:"-"`                 // The encrypted key
+	Created time.Time  `json:"created"`           // Datetime the key was created
+	Expires *time.Time `json:"expires,omitempty"` // Datetime the key expires, nil if never
+}
+
+// NewKeyID returns a new random Hawk key ID.
+func NewKeyID() (string, error) {
+	raw := make([]byte, keyIDSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// Active returns true if the key has not expired at the given time.
+func (key *NodeKey) Active(now time.Time) bool {
+	return key.Expires == nil || key.Expires.After(now)
+}
+
+// Save a new key to the database, setting its ID and Created timestamp. If
+// the key doesn't have a key ID a random one is assigned. Keys cannot be
+// changed once they're saved, they can only be expired by RotateNodeKey or
+// RevokeNodeKey.
+func (key *NodeKey) Save(db *sql.DB) error {
+	return key.insert(db)
+}
+
+// Helper function that inserts the key with either a database or transaction.
+func (key *NodeKey) insert(db execer) error {
+	if key.KeyID == "" {
+		id, err := NewKeyID()
+		if err != nil {
+			return err
+		}
+		key.KeyID = id
+	}
+
+	key.Created = time.Now()
+
+	query := "INSERT INTO node_keys (key_id, node_id, key, created, expires) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	row := db.QueryRow(query, key.KeyID, key.NodeID, key.Key, key.Created, key.Expires)
+	if err := row.Scan(&key.ID); err != nil {
+		return saveError("node key", err)
+	}
+
+	return nil
+}
+
+// CreateNodeKey generates a new key for the node that never expires and
+// saves it to the database. The plaintext key is returned so that it can be
+// given to the node.
+func CreateNodeKey(db *sql.DB, keys *KeyCipher, node Node) (NodeKey, string, error) {
+	return insertNodeKey(db, keys, node)
+}
+
+// CreateNode saves a new node and its first key, which never expires, in a
+// single transaction so that a node is never created without a key. New
+// nodes are reporters by default. The plaintext key is returned so that it
+// can be given to the node.
+func CreateNode(db *sql.DB, keys *KeyCipher, node *Node) (NodeKey, string, error) {
+	if node.Role == "" {
+		node.Role = RoleReporter
+	}
+
+	if err := node.Validate(); err != nil {
+		return NodeKey{}, "", err
+	}
+
+	txn, err := db.Begin()
+	if err != nil {
+		return NodeKey{}, "", err
+	}
+	defer txn.Rollback()
+
+	if err := node.insert(txn); err != nil {
+		return NodeKey{}, "", err
+	}
+
+	key, plaintext, err := insertNodeKey(txn, keys, *node)
+	if err != nil {
+		return NodeKey{}, "", err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return NodeKey{}, "", err
+	}
+
+	return key, plaintext, nil
+}
+
+// RotateNodeKey generates a new key for the node and expires its other keys
+// after the overlap, so that the clients can be reconfigured with the new key
+// before the old keys stop working. Keys that already expire sooner are not
+// changed. The plaintext key is returned so that it can be given to the node.
+func RotateNodeKey(db *sql.DB, keys *KeyCipher, node Node, overlap time.Duration) (NodeKey, string, error) {
+	txn, err := db.Begin()
+	if err != nil {
+		return NodeKey{}, "", err
+	}
+	defer txn.Rollback()
+
+	key, plaintext, err := replaceNodeKeys(txn, keys, node, time.Now().Add(overlap))
+	if err != nil {
+		return NodeKey{}, "", err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return NodeKey{}, "", err
+	}
+
+	return key, plaintext, nil
+}
+
+// RevokeNodeKey expires the key with the key ID immediately. If the key does
+// not exist, a NotFoundError is returned.
+func RevokeNodeKey(db *sql.DB, keyID string) error {
+	query := "UPDATE node_keys SET expires=$1 WHERE key_id=$2 AND (expires IS NULL OR expires > $1)"
+	res, err := db.Exec(query, time.Now(), keyID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		// The key may have already expired, which is not an error.
+		if _, err := GetNodeKey(db, keyID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetNodeKey by its Hawk key ID, attempts to return the key or an error
+// otherwise. If the key does not exist, a NotFoundError is returned.
+func GetNodeKey(db *sql.DB, keyID string) (NodeKey, error) {
+	var k NodeKey
+
+	row := db.QueryRow("SELECT "+nodeKeyColumns+" FROM node_keys WHERE key_id = $1", keyID)
+	err := row.Scan(&k.ID, &k.KeyID, &k.NodeID, &k.Key, &k.Created, &k.Expires)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return NodeKey{}, &NotFoundError{Resource: "node key", Key: keyID}
+	case err != nil:
+		return k, err
+	default:
+		return k, nil
+	}
+}
+
+// FetchNodeKeys returns all of the keys of the node, including the expired
+// keys, with the most recently created keys first.
+func FetchNodeKeys(db *sql.DB, nodeID int64) ([]NodeKey, error) {
+	return queryNodeKeys(db, "SELECT "+nodeKeyColumns+" FROM node_keys WHERE node_id = $1 ORDER BY created DESC, id DESC", nodeID)
+}
+
+// FetchActiveNodeKeys returns the keys of the node that have not expired,
+// with the most recently created keys first.
+func FetchActiveNodeKeys(db *sql.DB, nodeID int64) ([]NodeKey, error) {
+	return queryNodeKeys(db, "SELECT "+nodeKeyColumns+" FROM node_keys WHERE node_id = $1 AND (expires IS NULL OR expires > $2) ORDER BY created DESC, id DESC", nodeID, time.Now())
+}
+
+// The columns of the node_keys table in the order they are scanned into a
+// NodeKey.
+const nodeKeyColumns = "id, key_id, node_id, key, created, expires"
+
+// Implemented by both *sql.DB and *sql.Tx so that keys can be saved in a
+// transaction.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Helper function that generates a new key for the node and expires the
+// other keys of the node at the given time, unless they already expire
+// sooner.
+func replaceNodeKeys(db execer, keys *KeyCipher, node Node, expires time.Time) (NodeKey, string, error) {
+	query := "UPDATE node_keys SET expires=$1 WHERE node_id=$2 AND (expires IS NULL OR expires > $1)"
+	if _, err := db.Exec(query, expires, node.ID); err != nil {
+		return NodeKey{}, "", err
+	}
+
+	return insertNodeKey(db, keys, node)
+}
+
+// Helper function that generates a new key for the node that never expires
+// and inserts it with either a database or a transaction.
+func insertNodeKey(db execer, keys *KeyCipher, node Node) (NodeKey, string, error) {
+	plaintext, stored, err := keys.Generate()
+	if err != nil {
+		return NodeKey{}, "", err
+	}
+
+	key := NodeKey{NodeID: node.ID, Key: stored}
+	if err := key.insert(db); err != nil {
+		return NodeKey{}, "", err
+	}
+
+	return key, plaintext, nil
+}
+
+// Helper function that executes a query for node keys and scans the rows.
+func queryNodeKeys(db *sql.DB, query string, args ...interface{}) ([]NodeKey, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []NodeKey
+	for rows.Next() {
+		var k NodeKey
+		if err := rows.Scan(&k.ID, &k.KeyID, &k.NodeID, &k.Key, &k.Created, &k.Expires); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
@@ -0,0 +1,167 @@
+package scribo_test
+
+import (
+	"time"
+
+	. "github.com/bbengfort/scribo/scribo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NodeKeys", func() {
+
+	It("should create random hex key IDs", func() {
+		id1, err := NewKeyID()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(id1).Should(MatchRegexp("^[0-9a-f]{16}$"))
+
+		id2, err := NewKeyID()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(id1).ShouldNot(Equal(id2))
+	})
+
+	It("should report whether a key has expired", func() {
+		now := time.Now()
+		past := now.Add(-time.Minute)
+		future := now.Add(time.Minute)
+
+		Ω((&NodeKey{}).Active(now)).Should(BeTrue())
+		Ω((&NodeKey{Expires: &future}).Active(now)).Should(BeTrue())
+		Ω((&NodeKey{Expires: &past}).Active(now)).Should(BeFalse())
+		Ω((&NodeKey{Expires: &now}).Active(now)).Should(BeFalse())
+	})
+
+	Describe("database", func() {
+
+		var (
+			keys *KeyCipher
+			node Node
+		)
+
+		BeforeEach(func() {
+			var err error
+			keys, err = NewKeyCipher(testMasterKey)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			node = Node{Name: "apollo"}
+			_, err = node.Save(db)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			truncateTables(tables)
+		})
+
+		It("should create a key that never expires", func() {
+			key, plaintext, err := CreateNodeKey(db, keys, node)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(key.ID).Should(BeNumerically(">", 0))
+			Ω(key.KeyID).ShouldNot(BeEmpty())
+			Ω(key.Expires).Should(BeNil())
+
+			stored, err := GetNodeKey(db, key.KeyID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(stored.NodeID).Should(Equal(node.ID))
+			Ω(stored.Expires).Should(BeNil())
+			Ω(keys.Decrypt(stored.Key)).Should(Equal(plaintext))
+		})
+
+		It("should create a node with its first key", func() {
+			artemis := Node{Name: "artemis", Address: "10.0.0.5"}
+			key, plaintext, err := CreateNode(db, keys, &artemis)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(artemis.ID).Should(BeNumerically(">", 0))
+			Ω(artemis.Role).Should(Equal(RoleReporter))
+			Ω(key.NodeID).Should(Equal(artemis.ID))
+			Ω(key.Expires).Should(BeNil())
+
+			stored, err := GetNodeKey(db, key.KeyID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(keys.Decrypt(stored.Key)).Should(Equal(plaintext))
+		})
+
+		It("should not create a node or key if the node can't be saved", func() {
+			_, _, err := CreateNode(db, keys, &Node{Name: "apollo"})
+			Ω(err).Should(BeAssignableToTypeOf(&ConflictError{}))
+
+			var count int
+			Ω(db.QueryRow("SELECT count(*) FROM node_keys").Scan(&count)).Should(Succeed())
+			Ω(count).Should(BeZero())
+		})
+
+		It("should return a not found error for unknown key IDs", func() {
+			_, err := GetNodeKey(db, "notakey")
+			Ω(IsNotFound(err)).Should(BeTrue())
+
+			err = RevokeNodeKey(db, "notakey")
+			Ω(IsNotFound(err)).Should(BeTrue())
+		})
+
+		It("should expire the other keys after the overlap when rotated", func() {
+			old, _, err := CreateNodeKey(db, keys, node)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			key, _, err := RotateNodeKey(db, keys, node, time.Hour)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(key.KeyID).ShouldNot(Equal(old.KeyID))
+
+			all, err := FetchNodeKeys(db, node.ID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(all).Should(HaveLen(2))
+			Ω(all[0].KeyID).Should(Equal(key.KeyID))
+			Ω(all[0].Expires).Should(BeNil())
+			Ω(all[1].KeyID).Should(Equal(old.KeyID))
+			Ω(*all[1].Expires).Should(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+
+			active, err := FetchActiveNodeKeys(db, node.ID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(active).Should(HaveLen(2))
+		})
+
+		It("should not extend keys that expire before the overlap", func() {
+			old, _, err := CreateNodeKey(db, keys, node)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, _, err = RotateNodeKey(db, keys, node, time.Minute)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, _, err = RotateNodeKey(db, keys, node, time.Hour)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			stored, err := GetNodeKey(db, old.KeyID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(*stored.Expires).Should(BeTemporally("~", time.Now().Add(time.Minute), 30*time.Second))
+		})
+
+		It("should expire revoked keys immediately", func() {
+			key, _, err := CreateNodeKey(db, keys, node)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(RevokeNodeKey(db, key.KeyID)).Should(Succeed())
+			Ω(RevokeNodeKey(db, key.KeyID)).Should(Succeed())
+
+			active, err := FetchActiveNodeKeys(db, node.ID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(active).Should(BeEmpty())
+
+			all, err := FetchNodeKeys(db, node.ID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(all).Should(HaveLen(1))
+		})
+
+		It("should delete the keys of a deleted node", func() {
+			_, _, err := CreateNodeKey(db, keys, node)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = node.Delete(db)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			all, err := FetchNodeKeys(db, node.ID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(all).Should(BeEmpty())
+		})
+
+	})
+
+})
@@ -0,0 +1,176 @@
+package scribo
+
+import (
+	"container/list"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/tent/hawk-go"
+)
+
+// Nonce stores that can be selected with the nonce_store setting.
+const (
+	NonceStoreMemory   = "memory"
+	NonceStorePostgres = "postgres"
+)
+
+// NonceStore records the nonces of Hawk signed requests so that a captured
+// request cannot be replayed while its timestamp is within the skew allowed
+// by Hawk. Nonces only have to be unique for each node, so they are recorded
+// with the name of the node that signed the request.
+type NonceStore interface {
+	// Add records the nonce, returning false if it has already been recorded
+	// for the node and has not yet expired.
+	Add(id, nonce string, ts time.Time) (bool, error)
+}
+
+// NonceTTL returns how long nonces must be remembered after the timestamp of
+// the request, which is twice the timestamp skew allowed by Hawk to tolerate
+// the difference between the node's and the server's clocks.
+func NonceTTL() time.Duration {
+	return 2 * hawk.MaxTimestampSkew
+}
+
+// NewNonceStore creates the nonce store selected by the configuration.
+func NewNonceStore(conf *Config, db *sql.DB) NonceStore {
+	if conf.NonceStore == NonceStorePostgres {
+		return &PostgresNonces{DB: db}
+	}
+	return NewMemoryNonces(conf.NonceCacheSize)
+}
+
+//===========================================================================
+// In-memory nonce store
+//===========================================================================
+
+// MemoryNonces is a least recently used cache of nonces that expire after the
+// NonceTTL. If the cache is full the least recently used nonce is evicted even
+// if it has not expired, so the size should comfortably exceed the number of
+// requests that are received within the TTL. Nonces are only shared by the
+// requests to a single process; use PostgresNonces if there is more than one.
+type MemoryNonces struct {
+	sync.Mutex
+	size    int
+	entries map[nonceKey]*list.Element
+	order   *list.List // Most recently used entries are at the front
+}
+
+// Identifies a nonce used by a node.
+type nonceKey struct {
+	id    string
+	nonce string
+}
+
+// A nonce in the cache and when it expires.
+type nonceEntry struct {
+	key     nonceKey
+	expires time.Time
+}
+
+// NewMemoryNonces creates an in-memory cache that holds up to size nonces.
+func NewMemoryNonces(size int) *MemoryNonces {
+	return &MemoryNonces{
+		size:    size,
+		entries: make(map[nonceKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Add records the nonce, returning false if it is already in the cache.
+func (c *MemoryNonces) Add(id, nonce string, ts time.Time) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	key := nonceKey{id, nonce}
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*nonceEntry)
+		if now.Before(entry.expires) {
+			c.order.MoveToFront(elem)
+			return false, nil
+		}
+		c.remove(elem)
+	}
+
+	// Evict expired nonces and then the least recently used if still full.
+	for elem := c.order.Back(); elem != nil; elem = c.order.Back() {
+		if len(c.entries) < c.size && now.Before(elem.Value.(*nonceEntry).expires) {
+			break
+		}
+		c.remove(elem)
+	}
+
+	entry := &nonceEntry{key: key, expires: ts.Add(NonceTTL())}
+	c.entries[key] = c.order.PushFront(entry)
+	return true, nil
+}
+
+// Len returns the number of nonces in the cache.
+func (c *MemoryNonces) Len() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.entries)
+}
+
+// Helper function that removes an element from the cache.
+func (c *MemoryNonces) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*nonceEntry).key)
+}
+
+//===========================================================================
+// PostgreSQL nonce store
+//===========================================================================
+
+// PostgresNonces records nonces in the hawk_nonces table so that they are
+// shared by all of the processes that serve the API, e.g. multiple dynos.
+// Expired nonces are periodically deleted from the table.
+type PostgresNonces struct {
+	DB *sql.DB
+
+	mu     sync.Mutex
+	purged time.Time // When the expired nonces were last deleted
+}
+
+// Add records the nonce, returning false if it is already in the table. An
+// expired nonce in the table is replaced so that it can be used again.
+func (s *PostgresNonces) Add(id, nonce string, ts time.Time) (bool, error) {
+	if err := s.purge(); err != nil {
+		return false, err
+	}
+
+	query := `INSERT INTO hawk_nonces (node, nonce, expires) VALUES ($1, $2, $3)
+	ON CONFLICT (node, nonce) DO UPDATE SET expires=EXCLUDED.expires
+	WHERE hawk_nonces.expires < now()`
+
+	res, err := s.DB.Exec(query, id, nonce, ts.Add(NonceTTL()))
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// Helper function that deletes the expired nonces at most once per TTL.
+func (s *PostgresNonces) purge() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.purged) < NonceTTL() {
+		return nil
+	}
+
+	if _, err := s.DB.Exec("DELETE FROM hawk_nonces WHERE expires < now()"); err != nil {
+		return err
+	}
+
+	s.purged = time.Now()
+	return nil
+}
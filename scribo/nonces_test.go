@@ -0,0 +1,79 @@
+package scribo_test
+
+import (
+	"time"
+
+	. "github.com/bbengfort/scribo/scribo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Nonces", func() {
+
+	Describe("in memory", func() {
+
+		It("should reject a nonce that has already been used by a node", func() {
+			nonces := NewMemoryNonces(10)
+			now := time.Now()
+
+			Ω(nonces.Add("apollo", "abc123", now)).Should(BeTrue())
+			Ω(nonces.Add("apollo", "abc123", now)).Should(BeFalse())
+			Ω(nonces.Add("artemis", "abc123", now)).Should(BeTrue())
+			Ω(nonces.Len()).Should(Equal(2))
+		})
+
+		It("should accept a nonce again after it expires", func() {
+			nonces := NewMemoryNonces(10)
+			expired := time.Now().Add(-NonceTTL())
+
+			Ω(nonces.Add("apollo", "abc123", expired)).Should(BeTrue())
+			Ω(nonces.Add("apollo", "abc123", time.Now())).Should(BeTrue())
+			Ω(nonces.Add("apollo", "abc123", time.Now())).Should(BeFalse())
+		})
+
+		It("should evict expired nonces before the least recently used", func() {
+			nonces := NewMemoryNonces(2)
+			now := time.Now()
+
+			Ω(nonces.Add("apollo", "expired", now.Add(-NonceTTL()))).Should(BeTrue())
+			Ω(nonces.Add("apollo", "first", now)).Should(BeTrue())
+			Ω(nonces.Add("apollo", "second", now)).Should(BeTrue())
+			Ω(nonces.Len()).Should(Equal(2))
+			Ω(nonces.Add("apollo", "first", now)).Should(BeFalse())
+
+			// The cache is full so the least recently used nonce is evicted
+			Ω(nonces.Add("apollo", "third", now)).Should(BeTrue())
+			Ω(nonces.Len()).Should(Equal(2))
+			Ω(nonces.Add("apollo", "first", now)).Should(BeFalse())
+			Ω(nonces.Add("apollo", "second", now)).Should(BeTrue())
+		})
+
+	})
+
+	Describe("in PostgreSQL", func() {
+
+		AfterEach(func() {
+			truncateTables(tables)
+		})
+
+		It("should reject a nonce that has already been used by a node", func() {
+			nonces := &PostgresNonces{DB: db}
+			now := time.Now()
+
+			Ω(nonces.Add("apollo", "abc123", now)).Should(BeTrue())
+			Ω(nonces.Add("apollo", "abc123", now)).Should(BeFalse())
+			Ω(nonces.Add("artemis", "abc123", now)).Should(BeTrue())
+		})
+
+		It("should accept a nonce again after it expires", func() {
+			nonces := &PostgresNonces{DB: db}
+
+			Ω(nonces.Add("apollo", "abc123", time.Now().Add(-NonceTTL()))).Should(BeTrue())
+			Ω(nonces.Add("apollo", "abc123", time.Now())).Should(BeTrue())
+			Ω(nonces.Add("apollo", "abc123", time.Now())).Should(BeFalse())
+		})
+
+	})
+
+})
@@ -0,0 +1,169 @@
+package scribo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Limits on the number of items that are returned in a single page.
+const (
+	DefaultPageSize = 10
+	MaxPageSize     = 1000
+)
+
+// Page is the response envelope for paginated collections. If there are more
+// items available, Next contains the URL of the following page.
+type Page struct {
+	Count int         `json:"count"`           // Number of items in this page
+	Total *int64      `json:"total,omitempty"` // Number of items in all pages
+	Next  string      `json:"next,omitempty"`  // URL of the next page of items
+	Items interface{} `json:"items"`           // The items in this page
+}
+
+// Helper function to parse the limit query parameter of a request, returning
+// the default page size if the limit is not specified.
+func queryLimit(query url.Values) (int, error) {
+	limit, err := queryInt(query, "limit")
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case limit == 0:
+		return DefaultPageSize, nil
+	case limit < 0 || limit > MaxPageSize:
+		return 0, fmt.Errorf("limit must be between 1 and %d", MaxPageSize)
+	default:
+		return int(limit), nil
+	}
+}
+
+// Helper function to parse an integer query parameter; returns zero if the
+// parameter is not in the query.
+func queryInt(query url.Values, key string) (int64, error) {
+	val := query.Get(key)
+	if val == "" {
+		return 0, nil
+	}
+
+	num, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse %s: %q is not an integer", key, val)
+	}
+
+	return num, nil
+}
+
+// Helper function to parse a boolean query parameter; returns nil if the
+// parameter is not in the query so the filter can be ignored.
+func queryBool(query url.Values, key string) (*bool, error) {
+	val := query.Get(key)
+	if val == "" {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %q is not a boolean", key, val)
+	}
+
+	return &b, nil
+}
+
+// Helper function to parse an RFC 3339 timestamp query parameter; returns the
+// zero time if the parameter is not in the query.
+func queryTime(query url.Values, key string) (time.Time, error) {
+	val := query.Get(key)
+	if val == "" {
+		return time.Time{}, nil
+	}
+
+	ts, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not parse %s: %q is not an RFC 3339 timestamp", key, val)
+	}
+
+	return ts, nil
+}
+
+// Helper function that returns the URL of the next page of a collection by
+// replacing the value of the cursor parameter in the request's query.
+func nextPageURL(request *http.Request, param string, cursor string) string {
+	query := request.URL.Query()
+	query.Set(param, cursor)
+
+	next := url.URL{Path: request.URL.Path, RawQuery: query.Encode()}
+	return next.String()
+}
+
+// ParsePingQuery creates a PingQuery from the query parameters of a request,
+// e.g. /pings?source=1&timeout=false&from=2016-05-12T00:00:00Z&limit=50
+func ParsePingQuery(request *http.Request) (PingQuery, error) {
+	var q PingQuery
+	var err error
+
+	query := request.URL.Query()
+
+	if q.Limit, err = queryLimit(query); err != nil {
+		return q, err
+	}
+
+	if q.After, err = queryInt(query, "after"); err != nil {
+		return q, err
+	}
+
+	if q.Source, err = queryInt(query, "source"); err != nil {
+		return q, err
+	}
+
+	if q.Target, err = queryInt(query, "target"); err != nil {
+		return q, err
+	}
+
+	if q.Timeout, err = queryBool(query, "timeout"); err != nil {
+		return q, err
+	}
+
+	if q.From, err = queryTime(query, "from"); err != nil {
+		return q, err
+	}
+
+	if q.To, err = queryTime(query, "to"); err != nil {
+		return q, err
+	}
+
+	return q, nil
+}
+
+// ParseNodeQuery creates a NodeQuery from the query parameters of a request,
+// e.g. /nodes?name=apo&dns=bryant.bengfort.com&offset=20&limit=10
+func ParseNodeQuery(request *http.Request) (NodeQuery, error) {
+	var q NodeQuery
+	var err error
+
+	query := request.URL.Query()
+
+	if q.Limit, err = queryLimit(query); err != nil {
+		return q, err
+	}
+
+	offset, err := queryInt(query, "offset")
+	if err != nil {
+		return q, err
+	}
+
+	if offset < 0 {
+		return q, errors.New("offset must not be negative")
+	}
+
+	q.Offset = int(offset)
+	q.Name = query.Get("name")
+	q.Address = query.Get("address")
+	q.DNS = query.Get("dns")
+
+	return q, nil
+}
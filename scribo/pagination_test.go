@@ -0,0 +1,80 @@
+package scribo_test
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/bbengfort/scribo/scribo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pagination", func() {
+
+	Describe("parsing ping queries", func() {
+
+		It("should use the default page size with no query", func() {
+			request, _ := http.NewRequest(GET, "/pings", nil)
+			query, err := ParsePingQuery(request)
+
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(query.Limit).Should(Equal(DefaultPageSize))
+			Ω(query.After).Should(BeZero())
+			Ω(query.Timeout).Should(BeNil())
+			Ω(query.From.IsZero()).Should(BeTrue())
+		})
+
+		It("should parse all of the filters from the query", func() {
+			request, _ := http.NewRequest(GET, "/pings?after=42&limit=50&source=1&target=2&timeout=true&from=2016-05-12T00:00:00Z&to=2016-05-13T00:00:00Z", nil)
+			query, err := ParsePingQuery(request)
+
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(query.After).Should(Equal(int64(42)))
+			Ω(query.Limit).Should(Equal(50))
+			Ω(query.Source).Should(Equal(int64(1)))
+			Ω(query.Target).Should(Equal(int64(2)))
+			Ω(*query.Timeout).Should(BeTrue())
+			Ω(query.From).Should(Equal(time.Date(2016, 5, 12, 0, 0, 0, 0, time.UTC)))
+			Ω(query.To).Should(Equal(time.Date(2016, 5, 13, 0, 0, 0, 0, time.UTC)))
+		})
+
+		It("should reject limits larger than the maximum page size", func() {
+			request, _ := http.NewRequest(GET, "/pings?limit=100000", nil)
+			_, err := ParsePingQuery(request)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("should reject malformed filters", func() {
+			for _, url := range []string{"/pings?after=abc", "/pings?timeout=maybe", "/pings?from=yesterday"} {
+				request, _ := http.NewRequest(GET, url, nil)
+				_, err := ParsePingQuery(request)
+				Ω(err).Should(HaveOccurred(), url)
+			}
+		})
+
+	})
+
+	Describe("parsing node queries", func() {
+
+		It("should parse the search and pagination parameters", func() {
+			request, _ := http.NewRequest(GET, "/nodes?name=apo&address=127.0.0.1&dns=test.dyndns.net&offset=20&limit=5", nil)
+			query, err := ParseNodeQuery(request)
+
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(query.Name).Should(Equal("apo"))
+			Ω(query.Address).Should(Equal("127.0.0.1"))
+			Ω(query.DNS).Should(Equal("test.dyndns.net"))
+			Ω(query.Offset).Should(Equal(20))
+			Ω(query.Limit).Should(Equal(5))
+		})
+
+		It("should reject a negative offset", func() {
+			request, _ := http.NewRequest(GET, "/nodes?offset=-1", nil)
+			_, err := ParseNodeQuery(request)
+			Ω(err).Should(HaveOccurred())
+		})
+
+	})
+
+})
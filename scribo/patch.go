@@ -0,0 +1,141 @@
+package scribo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// NodePatch is a partial update to a node, decoded from a JSON Merge Patch
+// (RFC 7396) with DecodeMergePatch. Fields that are nil are not modified.
+type NodePatch struct {
+	Name    *string `json:"name"`
+	Address *string `json:"address"`
+	DNS     *string `json:"dns"`
+	Role    *string `json:"role"`
+}
+
+// Apply the patch to the node. The node should be validated afterward.
+func (p NodePatch) Apply(node *Node) {
+	if p.Name != nil {
+		node.Name = *p.Name
+	}
+
+	if p.Address != nil {
+		node.Address = *p.Address
+	}
+
+	if p.DNS != nil {
+		node.DNS = *p.DNS
+	}
+
+	if p.Role != nil {
+		node.Role = *p.Role
+	}
+}
+
+// PingPatch is a partial update to a ping, decoded from a JSON Merge Patch
+// (RFC 7396) with DecodeMergePatch. Fields that are nil are not modified.
+type PingPatch struct {
+	Source  *int64   `json:"source"`
+	Target  *int64   `json:"target"`
+	Payload *int     `json:"payload"`
+	Latency *float64 `json:"latency"`
+	Timeout *bool    `json:"timeout"`
+}
+
+// Apply the patch to the ping. The ping should be validated afterward.
+func (p PingPatch) Apply(ping *Ping) {
+	if p.Source != nil {
+		ping.Source = *p.Source
+	}
+
+	if p.Target != nil {
+		ping.Target = *p.Target
+	}
+
+	if p.Payload != nil {
+		ping.Payload = *p.Payload
+	}
+
+	if p.Latency != nil {
+		ping.Latency = *p.Latency
+	}
+
+	if p.Timeout != nil {
+		ping.Timeout = *p.Timeout
+	}
+}
+
+// DecodeMergePatch decodes a JSON Merge Patch document into a patch struct
+// whose fields are pointers, e.g. a NodePatch. Members of the document that
+// are null reset the field to its zero value, since none of the fields of a
+// resource can be removed. Members that are not fields of the patch, or that
+// have the wrong type, are returned as ValidationErrors.
+func DecodeMergePatch(data []byte, patch interface{}) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil || members == nil {
+		return &ValidationError{Reason: "a merge patch must be a JSON object"}
+	}
+
+	value := reflect.ValueOf(patch).Elem()
+	fields := make(map[string]reflect.Value, value.NumField())
+	for i := 0; i < value.NumField(); i++ {
+		name := strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0]
+		fields[name] = value.Field(i)
+	}
+
+	// Decode the members in order so that errors are reported consistently.
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs ValidationErrors
+	for _, name := range names {
+		raw := members[name]
+		field, ok := fields[name]
+		if !ok {
+			errs.Add(name, "cannot be updated")
+			continue
+		}
+
+		// A null member resets the field to its zero value.
+		if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			field.Set(reflect.New(field.Type().Elem()))
+			continue
+		}
+
+		if err := json.Unmarshal(raw, field.Addr().Interface()); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				errs.Add(name, fmt.Sprintf("must be %s", jsonType(typeErr.Type)))
+				continue
+			}
+			errs.Add(name, err.Error())
+		}
+	}
+
+	return errs.Err()
+}
+
+// Helper function that describes the JSON type that decodes into a Go type.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	default:
+		return fmt.Sprintf("a %s", t)
+	}
+}
@@ -0,0 +1,65 @@
+package scribo_test
+
+import (
+	. "github.com/bbengfort/scribo/scribo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Patch", func() {
+
+	It("should only update the fields in the patch", func() {
+		node := Node{ID: 1, Name: "apollo", Address: "108.51.64.223", DNS: "bryant.bengfort.com"}
+
+		var patch NodePatch
+		Ω(DecodeMergePatch([]byte(`{"address": "108.51.64.224"}`), &patch)).Should(Succeed())
+		Ω(patch.Name).Should(BeNil())
+
+		patch.Apply(&node)
+		Ω(node.Name).Should(Equal("apollo"))
+		Ω(node.Address).Should(Equal("108.51.64.224"))
+		Ω(node.DNS).Should(Equal("bryant.bengfort.com"))
+	})
+
+	It("should decode typed fields of a ping", func() {
+		ping := Ping{ID: 1, Source: 1, Target: 2, Payload: 64, Latency: 12.3}
+
+		var patch PingPatch
+		Ω(DecodeMergePatch([]byte(`{"source": 3, "payload": 128, "timeout": true}`), &patch)).Should(Succeed())
+
+		patch.Apply(&ping)
+		Ω(ping.Source).Should(Equal(int64(3)))
+		Ω(ping.Target).Should(Equal(int64(2)))
+		Ω(ping.Payload).Should(Equal(128))
+		Ω(ping.Latency).Should(Equal(12.3))
+		Ω(ping.Timeout).Should(BeTrue())
+	})
+
+	It("should reset fields that are null in the patch", func() {
+		node := Node{ID: 1, Name: "apollo", DNS: "bryant.bengfort.com"}
+
+		var patch NodePatch
+		Ω(DecodeMergePatch([]byte(`{"dns": null}`), &patch)).Should(Succeed())
+
+		patch.Apply(&node)
+		Ω(node.Name).Should(Equal("apollo"))
+		Ω(node.DNS).Should(BeEmpty())
+	})
+
+	It("should report invalid members of the patch", func() {
+		var patch PingPatch
+		err := DecodeMergePatch([]byte(`{"id": 4, "source": "apollo", "payload": 1.5}`), &patch)
+		Ω(err).Should(HaveOccurred())
+
+		fields := err.(ValidationErrors).Fields()
+		Ω(fields).Should(HaveKeyWithValue("id", "cannot be updated"))
+		Ω(fields).Should(HaveKeyWithValue("source", "must be an integer"))
+		Ω(fields).Should(HaveKeyWithValue("payload", "must be an integer"))
+
+		for _, doc := range []string{`[]`, `null`, `"apollo"`, `{`} {
+			Ω(DecodeMergePatch([]byte(doc), &patch)).Should(BeAssignableToTypeOf(&ValidationError{}))
+		}
+	})
+
+})
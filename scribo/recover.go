@@ -0,0 +1,73 @@
+package scribo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gorilla/context"
+)
+
+// RequestID returns the ID that identifies the request in the logs, creating
+// a new random ID for the request if it doesn't have one yet.
+func RequestID(r *http.Request) string {
+	if id, ok := context.Get(r, requestIDKey).(string); ok {
+		return id
+	}
+
+	id := newRequestID()
+	setRequestID(r, id)
+	return id
+}
+
+// Helper function that sets the ID that identifies the request in the logs.
+func setRequestID(r *http.Request, id string) {
+	context.Set(r, requestIDKey, id)
+}
+
+// Helper function that generates a random 16 character hex request ID.
+func newRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Recover is a decorator for http handlers that recovers from panics in the
+// inner handler, logging the panic and stack trace with the request ID. If
+// the inner handler has not yet written a response, the client receives a
+// JSON error response that refers to the request ID, which is signed if the
+// request was authenticated.
+func Recover(app *App, inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lw := &responseLogger{w: w}
+
+		defer func() {
+			if rec := recover(); rec != nil {
+				// Don't recover from intentional aborts of the response.
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				id := RequestID(r)
+				app.Log.Entry(LevelError, fmt.Sprintf("panic in %s %s: %v", r.Method, r.RequestURI, rec), Fields{
+					"request_id": id,
+					"stack":      string(debug.Stack()),
+				})
+
+				// The response can't be changed if it has already been started.
+				if lw.Status() != 0 {
+					return
+				}
+
+				err := fmt.Errorf("internal server error (request %s)", id)
+				writeJSON(app, lw, r, http.StatusInternalServerError, errorResponse(err, http.StatusInternalServerError))
+			}
+		}()
+
+		inner.ServeHTTP(lw, r)
+	})
+}
@@ -0,0 +1,60 @@
+package scribo_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/bbengfort/scribo/scribo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Recover", func() {
+
+	It("should return a JSON error when the handler panics", func() {
+		var id string
+		handler := Recover(&App{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id = RequestID(r)
+			var fields map[string]interface{}
+			_ = fields["source"].(int64)
+		}))
+
+		request, _ := http.NewRequest(PUT, "/pings/1", nil)
+		response := httptest.NewRecorder()
+		Ω(func() { handler.ServeHTTP(response, request) }).ShouldNot(Panic())
+
+		Ω(response.Code).Should(Equal(http.StatusInternalServerError))
+		Ω(response.Header().Get(CTKEY)).Should(Equal(CTJSON))
+
+		var data map[string]string
+		Ω(json.Unmarshal(response.Body.Bytes(), &data)).Should(Succeed())
+		Ω(data).Should(HaveKeyWithValue("code", "500"))
+		Ω(data["error"]).Should(ContainSubstring(id))
+	})
+
+	It("should not change a response that has already been written", func() {
+		handler := Recover(&App{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			panic("something went wrong")
+		}))
+
+		request, _ := http.NewRequest(GET, "/", nil)
+		response := httptest.NewRecorder()
+		Ω(func() { handler.ServeHTTP(response, request) }).ShouldNot(Panic())
+		Ω(response.Code).Should(Equal(http.StatusAccepted))
+		Ω(response.Body.Len()).Should(BeZero())
+	})
+
+	It("should identify a request by the same ID", func() {
+		request, _ := http.NewRequest(GET, "/", nil)
+		id := RequestID(request)
+		Ω(id).Should(HaveLen(16))
+		Ω(RequestID(request)).Should(Equal(id))
+
+		other, _ := http.NewRequest(GET, "/", nil)
+		Ω(RequestID(other)).ShouldNot(Equal(id))
+	})
+
+})
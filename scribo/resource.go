@@ -1,6 +1,7 @@
 package scribo
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -12,6 +13,7 @@ const (
 	GET    = "GET"
 	POST   = "POST"
 	PUT    = "PUT"
+	PATCH  = "PATCH"
 	DELETE = "DELETE"
 )
 
@@ -28,13 +30,18 @@ type Resource interface {
 	Get(app *App, request *http.Request) (int, interface{}, error)
 	Post(app *App, request *http.Request) (int, interface{}, error)
 	Put(app *App, request *http.Request) (int, interface{}, error)
+	Patch(app *App, request *http.Request) (int, interface{}, error)
 	Delete(app *App, request *http.Request) (int, interface{}, error)
 }
 
 // CreateResourceRoute returns a Route object, constructing the Handler and
 // Method from the Resource definition. This allows you to quickly add
-// Resources to the routes object for inclusion with the web app.
+// Resources to the routes object for inclusion with the web app. Requests
+// from nodes whose role is not permitted to use the method by the resource's
+// Permissions are forbidden, as are requests that aren't signed by a node for
+// any method other than GET unless the resource permits Anonymous.
 func CreateResourceRoute(resource Resource, name string, pattern string) Route {
+	permissions := resourcePermissions(resource)
 
 	var handler HandlerFunc
 	handler = func(app *App) http.HandlerFunc {
@@ -43,6 +50,21 @@ func CreateResourceRoute(resource Resource, name string, pattern string) Route {
 			var code int
 			var err error
 
+			// Check the role of the node that signed the request; unsigned
+			// requests can only read unless the resource is public.
+			node, ok := AuthenticatedNode(request)
+			switch {
+			case ok && !permissions.Permits(node.Role, request.Method):
+				err = fmt.Errorf("node %q with role %s is not permitted to %s %s", node.Name, node.Role, request.Method, request.URL.Path)
+			case !ok && request.Method != GET && !permissions.Permits(Anonymous, request.Method):
+				err = fmt.Errorf("requests that are not signed by a node are not permitted to %s %s", request.Method, request.URL.Path)
+			}
+
+			if err != nil {
+				writeJSON(app, w, request, http.StatusForbidden, errorResponse(err, http.StatusForbidden))
+				return
+			}
+
 			switch request.Method {
 			case GET:
 				code, data, err = resource.Get(app, request)
@@ -50,35 +72,43 @@ func CreateResourceRoute(resource Resource, name string, pattern string) Route {
 				code, data, err = resource.Post(app, request)
 			case PUT:
 				code, data, err = resource.Put(app, request)
+			case PATCH:
+				code, data, err = resource.Patch(app, request)
 			case DELETE:
 				code, data, err = resource.Delete(app, request)
 			default:
-				app.Abort(w, http.StatusNotImplemented)
+				err = fmt.Errorf("HTTP %s is not implemented", request.Method)
+				writeJSON(app, w, request, http.StatusNotImplemented, errorResponse(err, http.StatusNotImplemented))
+				return
 			}
 
-			// Handle errors from the resource
+			// Handle errors from the resource; typed errors from the database
+			// layer determine the status code regardless of the resource.
 			if err != nil {
-				if code == 0 {
+				if status, ok := ErrorStatus(err); ok {
+					code = status
+				} else if code == 0 {
 					code = http.StatusInternalServerError
 				}
 
-				app.JSONError(w, err, code)
-				return
+				data = errorResponse(err, code)
 			}
 
-			// Write the content type and the status code
-			w.Header().Set(CTKEY, CTJSON)
-			w.WriteHeader(code)
-
-			// Write the response data as JSON to the stream.
-			if err := json.NewEncoder(w).Encode(data); err != nil {
-				app.Error(w, err, http.StatusInternalServerError)
-				return
-			}
+			writeJSON(app, w, request, code, data)
 		}
 	}
 
-	return Route{name, []string{GET, POST, PUT, DELETE}, pattern, handler, true}
+	return Route{name, []string{GET, POST, PUT, PATCH, DELETE}, pattern, handler, true}
+}
+
+// CreatePublicResourceRoute returns a Route for a Resource like
+// CreateResourceRoute, except that requests to the Resource do not have to
+// be signed by a node. Unsigned requests can only use the methods other than
+// GET that the Resource's Permissions grant to Anonymous.
+func CreatePublicResourceRoute(resource Resource, name string, pattern string) Route {
+	route := CreateResourceRoute(resource, name, pattern)
+	route.Authorize = false
+	return route
 }
 
 type (
@@ -91,6 +121,9 @@ type (
 	// PutNotSupported allows the creation of Resources with no Put method.
 	PutNotSupported struct{}
 
+	// PatchNotSupported allows the creation of Resources with no Patch method.
+	PatchNotSupported struct{}
+
 	// DeleteNotSupported allows the creation of Resources with no Delete method.
 	DeleteNotSupported struct{}
 )
@@ -110,11 +143,38 @@ func (r PutNotSupported) Put(app *App, request *http.Request) (int, interface{},
 	return notSupported(PUT)
 }
 
+// Patch returns method not allowed (405) on PatchNotSupported types.
+func (r PatchNotSupported) Patch(app *App, request *http.Request) (int, interface{}, error) {
+	return notSupported(PATCH)
+}
+
 // Delete returns method not allowed (405) on DeleteNotSupported types.
 func (r DeleteNotSupported) Delete(app *App, request *http.Request) (int, interface{}, error) {
 	return notSupported(DELETE)
 }
 
+// Helper function that writes the data returned by a resource (or an error
+// response) as JSON. The response is signed with a Hawk Server-Authorization
+// header that includes a hash of the body if the request was signed by a node.
+func writeJSON(app *App, w http.ResponseWriter, request *http.Request, code int, data interface{}) {
+	// No content responses must not have a body
+	var body []byte
+	if code != http.StatusNoContent {
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(data); err != nil {
+			app.Error(w, err, http.StatusInternalServerError)
+			return
+		}
+		body = buf.Bytes()
+	}
+
+	// Write the content type, signature, and the status code
+	w.Header().Set(CTKEY, CTJSON)
+	SignResponse(w, request, CTJSON, body)
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
 // Helper function to return a not reported status code and reason.
 func notSupported(method string) (int, interface{}, error) {
 	response := make(map[string]string)
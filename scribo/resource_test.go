@@ -33,11 +33,41 @@ func (r BookResource) Put(app *App, request *http.Request) (int, interface{}, er
 	return 202, nil, nil
 }
 
+// Patch returns a single book object after a partial update
+func (r BookResource) Patch(app *App, request *http.Request) (int, interface{}, error) {
+	data := make(map[string]string)
+	data["title"] = "Data Analytics with Hadoop"
+	return 200, data, nil
+}
+
 // Delete returns a 204 (no content) after delete
 func (r BookResource) Delete(app *App, request *http.Request) (int, interface{}, error) {
 	return 204, nil, nil
 }
 
+// Permissions allows unsigned requests to use every method of the book
+func (r BookResource) Permissions() Permissions {
+	return Permissions{POST: {Anonymous}, PUT: {Anonymous}, PATCH: {Anonymous}, DELETE: {Anonymous}}
+}
+
+// MissingResource returns typed errors from the database layer
+type MissingResource struct {
+	GetNotSupported
+	PostNotSupported
+	PutNotSupported
+	PatchNotSupported
+}
+
+// Delete returns a not found error with an internal server error status
+func (r MissingResource) Delete(app *App, request *http.Request) (int, interface{}, error) {
+	return 500, nil, &NotFoundError{Resource: "book", Key: 42}
+}
+
+// Permissions allows unsigned requests to delete missing books
+func (r MissingResource) Permissions() Permissions {
+	return Permissions{DELETE: {Anonymous}}
+}
+
 var _ = Describe("Resource", func() {
 
 	Describe("Route Creation", func() {
@@ -50,17 +80,18 @@ var _ = Describe("Resource", func() {
 			Ω(route.Pattern).Should(Equal("/books"))
 		})
 
-		It("should route to GET, POST, PUT, and DELETE methods", func() {
+		It("should route to GET, POST, PUT, PATCH, and DELETE methods", func() {
 			route := CreateResourceRoute(BookResource{}, "BookResource", "/books")
 			Ω(route.Methods).Should(ContainElement(GET))
 			Ω(route.Methods).Should(ContainElement(POST))
 			Ω(route.Methods).Should(ContainElement(PUT))
+			Ω(route.Methods).Should(ContainElement(PATCH))
 			Ω(route.Methods).Should(ContainElement(DELETE))
 		})
 
 		It("should handle GET requests properly", func() {
 			var handle http.HandlerFunc
-			app := &App{"", "", nil, nil, nil}
+			app := &App{}
 			request, _ := http.NewRequest(GET, "/books", nil)
 			route := CreateResourceRoute(BookResource{}, "BookResource", "/books")
 
@@ -79,7 +110,7 @@ var _ = Describe("Resource", func() {
 
 		It("should handle POST requests properly", func() {
 			var handle http.HandlerFunc
-			app := &App{"", "", nil, nil, nil}
+			app := &App{}
 			request, _ := http.NewRequest(POST, "/books", nil)
 			route := CreateResourceRoute(BookResource{}, "BookResource", "/books")
 
@@ -98,7 +129,7 @@ var _ = Describe("Resource", func() {
 
 		It("should handle PUT requests properly", func() {
 			var handle http.HandlerFunc
-			app := &App{"", "", nil, nil, nil}
+			app := &App{}
 			request, _ := http.NewRequest(PUT, "/books", nil)
 			route := CreateResourceRoute(BookResource{}, "BookResource", "/books")
 
@@ -115,9 +146,21 @@ var _ = Describe("Resource", func() {
 			Ω(writer.Body).Should(MatchJSON("null"))
 		})
 
+		It("should handle PATCH requests properly", func() {
+			app := &App{}
+			request, _ := http.NewRequest(PATCH, "/books", nil)
+			route := CreateResourceRoute(BookResource{}, "BookResource", "/books")
+
+			writer := httptest.NewRecorder()
+			route.Handler(app)(writer, request)
+
+			Ω(writer.Code).Should(Equal(200))
+			Ω(writer.Body).Should(MatchJSON("{\"title\": \"Data Analytics with Hadoop\"}"))
+		})
+
 		It("should handle DELETE requests properly", func() {
 			var handle http.HandlerFunc
-			app := &App{"", "", nil, nil, nil}
+			app := &App{}
 			request, _ := http.NewRequest(DELETE, "/books", nil)
 			route := CreateResourceRoute(BookResource{}, "BookResource", "/books")
 
@@ -131,17 +174,43 @@ var _ = Describe("Resource", func() {
 			Ω(writer.Code).Should(Equal(204))
 			Ω(headers).Should(HaveKey(CTKEY))
 			Ω(headers[CTKEY][0]).Should(Equal(CTJSON))
-			Ω(writer.Body).Should(MatchJSON("null"))
+			Ω(writer.Body.Len()).Should(BeZero())
 		})
 
 	})
 
+	It("should forbid unsigned requests that change resources that are not public", func() {
+		app := &App{}
+		route := CreateResourceRoute(NodeDetail{}, "NodeDetail", "/nodes/{ID}")
+
+		for _, method := range []string{POST, PUT, PATCH, DELETE} {
+			request, _ := http.NewRequest(method, "/nodes/1", nil)
+			writer := httptest.NewRecorder()
+			route.Handler(app)(writer, request)
+
+			Ω(writer.Code).Should(Equal(http.StatusForbidden))
+			Ω(writer.Body.String()).Should(ContainSubstring("not signed by a node"))
+		}
+	})
+
+	It("should map typed errors to status codes", func() {
+		app := &App{}
+		request, _ := http.NewRequest(DELETE, "/books/42", nil)
+		route := CreateResourceRoute(MissingResource{}, "MissingResource", "/books/{ID}")
+
+		writer := httptest.NewRecorder()
+		route.Handler(app)(writer, request)
+		Ω(writer.Code).Should(Equal(http.StatusNotFound))
+		Ω(writer.Body).Should(MatchJSON(`{"code": "404", "error": "book 42 not found"}`))
+	})
+
 	Describe("Unresponsive Resource", func() {
 
 		type Unresponsive struct {
 			GetNotSupported
 			PostNotSupported
 			PutNotSupported
+			PatchNotSupported
 			DeleteNotSupported
 		}
 
@@ -157,7 +226,7 @@ var _ = Describe("Resource", func() {
 		BeforeEach(func() {
 			// Set up the test suite
 			resource = Unresponsive{}
-			app = &App{"", "", nil, nil, nil}
+			app = &App{}
 			url = "/test"
 		})
 
@@ -206,6 +275,17 @@ var _ = Describe("Resource", func() {
 			Ω(result["message"]).Should(Equal("This resource does not support HTTP PUT."))
 		})
 
+		It("should not respond to PATCH requests", func() {
+			request, _ = http.NewRequest(PATCH, url, nil)
+			code, data, err := resource.Patch(app, request)
+
+			Ω(code).Should(Equal(http.StatusMethodNotAllowed))
+			Ω(err).Should(BeNil())
+
+			result, _ := data.(map[string]string)
+			Ω(result["message"]).Should(Equal("This resource does not support HTTP PATCH."))
+		})
+
 		It("should not respond to DELETE requests", func() {
 			request, _ = http.NewRequest(GET, url, nil)
 			code, data, err := resource.Delete(app, request)
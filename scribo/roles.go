@@ -0,0 +1,75 @@
+package scribo
+
+import "strings"
+
+// Roles of the nodes that determine which methods of the resources they are
+// permitted to use. Admins are permitted to use every method, reporters can
+// read everything and create their own pings, and read-only nodes can only
+// read from the API.
+const (
+	RoleAdmin    = "admin"
+	RoleReporter = "reporter"
+	RoleReadOnly = "read-only"
+)
+
+// Anonymous is the role of requests that are not signed by a node, e.g. to
+// public routes. It is not a valid node role; resources that can be changed
+// without authentication must permit it explicitly in their Permissions.
+const Anonymous = "anonymous"
+
+// Roles is the list of valid node roles, which can be used to declare that
+// every node is permitted to use a method.
+var Roles = []string{RoleAdmin, RoleReporter, RoleReadOnly}
+
+// ValidRole returns true if the role is one of the node roles.
+func ValidRole(role string) bool {
+	for _, valid := range Roles {
+		if role == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions declares the roles that are permitted to use each HTTP method
+// of a resource. Admins are permitted to use every method, so methods that
+// are not declared can only be used by admins.
+type Permissions map[string][]string
+
+// Permits returns true if the role is permitted to use the method.
+func (p Permissions) Permits(role, method string) bool {
+	if role == RoleAdmin {
+		return true
+	}
+
+	for _, permitted := range p[method] {
+		if role == permitted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authorizer is implemented by resources that declare the roles permitted to
+// use their methods. Resources that don't implement it use DefaultPermissions.
+type Authorizer interface {
+	Permissions() Permissions
+}
+
+// DefaultPermissions allows every node to read a resource but only admins to
+// change it.
+var DefaultPermissions = Permissions{GET: Roles}
+
+// Helper function that returns the permissions declared by a resource.
+func resourcePermissions(resource Resource) Permissions {
+	if authorizer, ok := resource.(Authorizer); ok {
+		return authorizer.Permissions()
+	}
+	return DefaultPermissions
+}
+
+// Helper function that describes the valid roles in validation errors.
+func rolesList() string {
+	return strings.Join(Roles, ", ")
+}
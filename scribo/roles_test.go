@@ -0,0 +1,44 @@
+package scribo_test
+
+import (
+	. "github.com/bbengfort/scribo/scribo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Roles", func() {
+
+	It("should validate roles", func() {
+		for _, role := range Roles {
+			Ω(ValidRole(role)).Should(BeTrue())
+		}
+
+		Ω(ValidRole("")).Should(BeFalse())
+		Ω(ValidRole("Admin")).Should(BeFalse())
+	})
+
+	It("should permit the declared roles to use a method", func() {
+		permissions := PingCollection{}.Permissions()
+		Ω(permissions.Permits(RoleReporter, GET)).Should(BeTrue())
+		Ω(permissions.Permits(RoleReadOnly, GET)).Should(BeTrue())
+		Ω(permissions.Permits(RoleReporter, POST)).Should(BeTrue())
+		Ω(permissions.Permits(RoleReadOnly, POST)).Should(BeFalse())
+		Ω(permissions.Permits("", GET)).Should(BeFalse())
+	})
+
+	It("should permit admins to use every method", func() {
+		permissions := Permissions{}
+		for _, method := range []string{GET, POST, PUT, PATCH, DELETE} {
+			Ω(permissions.Permits(RoleAdmin, method)).Should(BeTrue())
+			Ω(permissions.Permits(RoleReporter, method)).Should(BeFalse())
+		}
+	})
+
+	It("should only permit admins to change resources by default", func() {
+		Ω(DefaultPermissions.Permits(RoleReadOnly, GET)).Should(BeTrue())
+		Ω(DefaultPermissions.Permits(RoleReporter, PUT)).Should(BeFalse())
+		Ω(DefaultPermissions.Permits(RoleAdmin, DELETE)).Should(BeTrue())
+	})
+
+})
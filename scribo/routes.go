@@ -21,8 +21,23 @@ var routes = Routes{
 	Route{
 		"Index", []string{GET}, "/", Index, false,
 	},
+	Route{
+		"Metrics", []string{GET}, "/metrics", MetricsHandler, false,
+	},
+	Route{
+		"Healthz", []string{GET}, "/healthz", Healthz, false,
+	},
+	Route{
+		"Readyz", []string{GET}, "/readyz", Readyz, false,
+	},
 	CreateResourceRoute(NodeCollection{}, "NodeCollection", "/nodes"),
 	CreateResourceRoute(NodeDetail{}, "NodeDetail", "/nodes/{ID}"),
 	CreateResourceRoute(PingCollection{}, "PingCollection", "/pings"),
+	CreateResourceRoute(PingBatch{}, "PingBatch", "/pings/batch"),
+	CreateResourceRoute(PingSeries{}, "PingSeries", "/pings/series"),
 	CreateResourceRoute(PingDetail{}, "PingDetail", "/pings/{ID}"),
+	CreateResourceRoute(LatencyStatistics{}, "LatencyStatistics", "/stats/latency"),
+	CreateResourceRoute(NetworkMatrix{}, "NetworkMatrix", "/stats/matrix"),
+	CreateResourceRoute(EnrollmentTokenCollection{}, "EnrollmentTokenCollection", "/enrollment-tokens"),
+	CreatePublicResourceRoute(EnrollmentResource{}, "Enrollment", "/enroll"),
 }
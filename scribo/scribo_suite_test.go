@@ -20,7 +20,7 @@ func TestScribo(t *testing.T) {
 var (
 	db         *sql.DB
 	app        *scribo.App
-	migrations []string
+	migrations scribo.Migrations
 	tables     []string
 )
 
@@ -0,0 +1,332 @@
+package scribo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// StatsQuery describes the pings that are aggregated into latency statistics.
+// Zero values are ignored, e.g. a zero From time means since the beginning.
+type StatsQuery struct {
+	Source int64     // Only pings reported by this source node
+	Target int64     // Only pings sent to this target node
+	From   time.Time // Only pings created at or after this time
+	To     time.Time // Only pings created before this time
+}
+
+// LatencySummary is the set of aggregates computed over a group of pings.
+// Latency aggregates are computed only from pings that did not time out.
+type LatencySummary struct {
+	Count       int64   `json:"count"`        // Number of pings in the group
+	Timeouts    int64   `json:"timeouts"`     // Number of pings that timed out
+	TimeoutRate float64 `json:"timeout_rate"` // Ratio of timeouts to pings
+	Min         float64 `json:"min"`          // Minimum latency in ms
+	Max         float64 `json:"max"`          // Maximum latency in ms
+	Mean        float64 `json:"mean"`         // Mean latency in ms
+	StdDev      float64 `json:"stddev"`       // Sample standard deviation in ms
+	P50         float64 `json:"p50"`          // Median latency in ms
+	P90         float64 `json:"p90"`          // 90th percentile latency in ms
+	P99         float64 `json:"p99"`          // 99th percentile latency in ms
+}
+
+// Helper function that returns the scan destinations for the aggregates in
+// the same order as the latencyAggregates expressions.
+func (s *LatencySummary) fields() []interface{} {
+	return []interface{}{&s.Count, &s.Timeouts, &s.TimeoutRate, &s.Min, &s.Max, &s.Mean, &s.StdDev, &s.P50, &s.P90, &s.P99}
+}
+
+// LatencyStats is a summary of the pings between a source and target node.
+type LatencyStats struct {
+	Source int64 `json:"source"` // The ID of the source node
+	Target int64 `json:"target"` // The ID of the target node
+	LatencySummary
+}
+
+// SeriesQuery describes a time series of latency summaries, grouping the
+// pings matching the stats query into buckets of a fixed width.
+type SeriesQuery struct {
+	StatsQuery
+	Bucket time.Duration // The width of each bucket in the series
+}
+
+// LatencySeries is a time series of latency summaries. Buckets that have no
+// pings are omitted from the series.
+type LatencySeries struct {
+	Source  int64          `json:"source,omitempty"` // The ID of the source node
+	Target  int64          `json:"target,omitempty"` // The ID of the target node
+	Bucket  string         `json:"bucket"`           // The width of each bucket
+	From    time.Time      `json:"from"`             // Start of the series
+	To      time.Time      `json:"to"`               // End of the series
+	Buckets []SeriesBucket `json:"buckets"`          // The buckets in the series
+}
+
+// SeriesBucket is the latency summary of the pings in a single bucket.
+type SeriesBucket struct {
+	Time time.Time `json:"time"` // The start of the bucket
+	LatencySummary
+}
+
+// LatencyMatrix summarizes the health of the entire network as a square
+// matrix of the pings between every pair of registered nodes. The rows of the
+// matrix are the sources and the columns are the targets, both ordered by the
+// nodes in the matrix.
+type LatencyMatrix struct {
+	Nodes Nodes          `json:"nodes"` // The rows and columns of the matrix
+	Cells [][]MatrixCell `json:"cells"` // Cells[i][j] are pings from i to j
+}
+
+// MatrixCell is a summary of the pings from a source to a target node in the
+// latency matrix. If the count is zero, there is no data for the pair.
+type MatrixCell struct {
+	Count       int64   `json:"count"`        // Number of pings in the window
+	Median      float64 `json:"median"`       // Median latency in ms
+	TimeoutRate float64 `json:"timeout_rate"` // Ratio of timeouts to pings
+}
+
+// Helper function that builds the WHERE clause for the filters of the query.
+func (q StatsQuery) where() *whereClause {
+	where := new(whereClause)
+
+	if q.Source > 0 {
+		where.Add("source_id = $%d", q.Source)
+	}
+
+	if q.Target > 0 {
+		where.Add("target_id = $%d", q.Target)
+	}
+
+	if !q.From.IsZero() {
+		where.Add("created >= $%d", q.From)
+	}
+
+	if !q.To.IsZero() {
+		where.Add("created < $%d", q.To)
+	}
+
+	return where
+}
+
+// ParseStatsQuery creates a StatsQuery from the query parameters of a request,
+// e.g. /stats/latency?source=1&from=2016-05-12T00:00:00Z
+func ParseStatsQuery(request *http.Request) (StatsQuery, error) {
+	var q StatsQuery
+	var err error
+
+	query := request.URL.Query()
+
+	if q.Source, err = queryInt(query, "source"); err != nil {
+		return q, err
+	}
+
+	if q.Target, err = queryInt(query, "target"); err != nil {
+		return q, err
+	}
+
+	if q.From, err = queryTime(query, "from"); err != nil {
+		return q, err
+	}
+
+	if q.To, err = queryTime(query, "to"); err != nil {
+		return q, err
+	}
+
+	return q, nil
+}
+
+// Limits on the series that can be requested, to keep the queries bounded.
+const (
+	DefaultBucket    = time.Hour
+	DefaultWindow    = 24 * time.Hour
+	MaxSeriesBuckets = 10000
+)
+
+// ParseSeriesQuery creates a SeriesQuery from the query parameters of a
+// request, e.g. /pings/series?source=1&target=2&bucket=5m&from=2016-05-12T00:00:00Z
+// If no window is specified, the series covers the last day.
+func ParseSeriesQuery(request *http.Request) (SeriesQuery, error) {
+	var q SeriesQuery
+	var err error
+
+	if q.StatsQuery, err = ParseStatsQuery(request); err != nil {
+		return q, err
+	}
+
+	q.Bucket = DefaultBucket
+	if bucket := request.URL.Query().Get("bucket"); bucket != "" {
+		if q.Bucket, err = time.ParseDuration(bucket); err != nil {
+			return q, fmt.Errorf("could not parse bucket: %q is not a duration", bucket)
+		}
+	}
+
+	if q.Bucket < time.Second {
+		return q, errors.New("bucket must be at least one second wide")
+	}
+
+	if err := q.StatsQuery.window(); err != nil {
+		return q, err
+	}
+
+	if q.To.Sub(q.From)/q.Bucket > MaxSeriesBuckets {
+		return q, fmt.Errorf("the window contains more than %d buckets", MaxSeriesBuckets)
+	}
+
+	return q, nil
+}
+
+// ParseMatrixQuery creates a StatsQuery for the latency matrix from the query
+// parameters of a request, e.g. /stats/matrix?from=2016-05-12T00:00:00Z
+// If no window is specified, the matrix covers the last day like the matrix
+// on the dashboard.
+func ParseMatrixQuery(request *http.Request) (StatsQuery, error) {
+	q, err := ParseStatsQuery(request)
+	if err != nil {
+		return q, err
+	}
+
+	return q, q.window()
+}
+
+// Helper function that defaults the window of the query to the DefaultWindow
+// ending now, and checks that the window is not empty.
+func (q *StatsQuery) window() error {
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+
+	if q.From.IsZero() {
+		q.From = q.To.Add(-DefaultWindow)
+	}
+
+	if !q.From.Before(q.To) {
+		return errors.New("from must be before to")
+	}
+
+	return nil
+}
+
+// The aggregate expressions shared by the latency statistics queries; the
+// latency aggregates ignore pings that timed out and default to zero.
+const latencyAggregates = `count(*),
+	count(*) FILTER (WHERE timeout),
+	avg(timeout::int)::float8,
+	coalesce(min(latency) FILTER (WHERE NOT timeout), 0),
+	coalesce(max(latency) FILTER (WHERE NOT timeout), 0),
+	coalesce(avg(latency) FILTER (WHERE NOT timeout), 0),
+	coalesce(stddev_samp(latency) FILTER (WHERE NOT timeout), 0),
+	coalesce(percentile_cont(0.5) WITHIN GROUP (ORDER BY latency) FILTER (WHERE NOT timeout), 0),
+	coalesce(percentile_cont(0.9) WITHIN GROUP (ORDER BY latency) FILTER (WHERE NOT timeout), 0),
+	coalesce(percentile_cont(0.99) WITHIN GROUP (ORDER BY latency) FILTER (WHERE NOT timeout), 0)`
+
+// FetchLatencyStats computes the latency statistics for every source and
+// target pair that has pings matching the query, ordered by source and target.
+func FetchLatencyStats(db *sql.DB, q StatsQuery) ([]LatencyStats, error) {
+	stats := make([]LatencyStats, 0)
+	where := q.where()
+
+	query := "SELECT source_id, target_id, " + latencyAggregates + " FROM pings" + where.String() + " GROUP BY source_id, target_id ORDER BY source_id, target_id"
+
+	rows, err := db.Query(query, where.Args()...)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s LatencyStats
+		dest := append([]interface{}{&s.Source, &s.Target}, s.fields()...)
+		if err := rows.Scan(dest...); err != nil {
+			return stats, err
+		}
+
+		stats = append(stats, s)
+	}
+
+	return stats, rows.Err()
+}
+
+// FetchLatencyMatrix computes the median latency and timeout rate between
+// every pair of registered nodes for the pings in the time window of the
+// query. The source and target filters of the query are ignored.
+func FetchLatencyMatrix(db *sql.DB, q StatsQuery) (LatencyMatrix, error) {
+	var matrix LatencyMatrix
+	var err error
+
+	// Fetch all of the nodes and order them by ID for a stable layout.
+	if matrix.Nodes, err = QueryNodes(db, NodeQuery{}); err != nil {
+		return matrix, err
+	}
+
+	if matrix.Nodes == nil {
+		matrix.Nodes = Nodes{}
+	}
+
+	sort.Slice(matrix.Nodes, func(i, j int) bool {
+		return matrix.Nodes[i].ID < matrix.Nodes[j].ID
+	})
+
+	// Compute the latency statistics for all pairs in the time window.
+	q.Source, q.Target = 0, 0
+	stats, err := FetchLatencyStats(db, q)
+	if err != nil {
+		return matrix, err
+	}
+
+	index := make(map[int64]int, len(matrix.Nodes))
+	matrix.Cells = make([][]MatrixCell, len(matrix.Nodes))
+	for i, node := range matrix.Nodes {
+		index[node.ID] = i
+		matrix.Cells[i] = make([]MatrixCell, len(matrix.Nodes))
+	}
+
+	for _, s := range stats {
+		i, iok := index[s.Source]
+		j, jok := index[s.Target]
+		if iok && jok {
+			matrix.Cells[i][j] = MatrixCell{Count: s.Count, Median: s.P50, TimeoutRate: s.TimeoutRate}
+		}
+	}
+
+	return matrix, nil
+}
+
+// FetchLatencySeries computes a latency summary for each fixed width bucket
+// of the pings matching the query. Buckets are aligned to the Unix epoch so
+// that the same bucket boundaries are used regardless of the window.
+func FetchLatencySeries(db *sql.DB, q SeriesQuery) (LatencySeries, error) {
+	series := LatencySeries{
+		Source:  q.Source,
+		Target:  q.Target,
+		Bucket:  q.Bucket.String(),
+		From:    q.From,
+		To:      q.To,
+		Buckets: make([]SeriesBucket, 0),
+	}
+
+	where := q.where()
+	args := append(where.Args(), q.Bucket.Seconds())
+
+	bucket := fmt.Sprintf("to_timestamp(floor(extract(epoch FROM created)::float8 / $%d::float8) * $%d::float8)", len(args), len(args))
+	query := "SELECT " + bucket + " AS bucket, " + latencyAggregates + " FROM pings" + where.String() + " GROUP BY bucket ORDER BY bucket"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return series, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b SeriesBucket
+		dest := append([]interface{}{&b.Time}, b.fields()...)
+		if err := rows.Scan(dest...); err != nil {
+			return series, err
+		}
+
+		series.Buckets = append(series.Buckets, b)
+	}
+
+	return series, rows.Err()
+}
@@ -0,0 +1,147 @@
+package scribo_test
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/bbengfort/scribo/scribo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stats", func() {
+
+	AfterEach(func() {
+		truncateTables(tables)
+	})
+
+	It("should parse a stats query from the request", func() {
+		request, _ := http.NewRequest(GET, "/stats/latency?source=1&target=2&from=2016-05-12T00:00:00Z", nil)
+		query, err := ParseStatsQuery(request)
+
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(query.Source).Should(Equal(int64(1)))
+		Ω(query.Target).Should(Equal(int64(2)))
+		Ω(query.From).Should(Equal(time.Date(2016, 5, 12, 0, 0, 0, 0, time.UTC)))
+		Ω(query.To.IsZero()).Should(BeTrue())
+	})
+
+	It("should parse a series query with a default window", func() {
+		request, _ := http.NewRequest(GET, "/pings/series?source=1&bucket=5m", nil)
+		query, err := ParseSeriesQuery(request)
+
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(query.Source).Should(Equal(int64(1)))
+		Ω(query.Bucket).Should(Equal(5 * time.Minute))
+		Ω(query.To).Should(BeTemporally("~", time.Now(), time.Second))
+		Ω(query.To.Sub(query.From)).Should(Equal(DefaultWindow))
+	})
+
+	It("should parse a matrix query with the default window of the dashboard", func() {
+		request, _ := http.NewRequest(GET, "/stats/matrix?source=1", nil)
+		query, err := ParseMatrixQuery(request)
+
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(query.Source).Should(Equal(int64(1)))
+		Ω(query.To).Should(BeTemporally("~", time.Now(), time.Second))
+		Ω(query.To.Sub(query.From)).Should(Equal(DefaultWindow))
+
+		request, _ = http.NewRequest(GET, "/stats/matrix?from=2016-05-12T00:00:00Z&to=2016-05-13T00:00:00Z", nil)
+		query, err = ParseMatrixQuery(request)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(query.From).Should(Equal(time.Date(2016, 5, 12, 0, 0, 0, 0, time.UTC)))
+		Ω(query.To).Should(Equal(time.Date(2016, 5, 13, 0, 0, 0, 0, time.UTC)))
+
+		request, _ = http.NewRequest(GET, "/stats/matrix?from=2016-05-13T00:00:00Z&to=2016-05-12T00:00:00Z", nil)
+		_, err = ParseMatrixQuery(request)
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should reject series queries with too many buckets", func() {
+		for _, url := range []string{"/pings/series?bucket=1ms", "/pings/series?bucket=1s&from=2016-01-01T00:00:00Z", "/pings/series?bucket=fast"} {
+			request, _ := http.NewRequest(GET, url, nil)
+			_, err := ParseSeriesQuery(request)
+			Ω(err).Should(HaveOccurred(), url)
+		}
+	})
+
+	Describe("latency statistics", func() {
+
+		BeforeEach(func() {
+			for _, name := range []string{"apollo", "artemis"} {
+				node := &Node{Name: name}
+				_, err := node.Save(db)
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+
+			pings := Pings{
+				{Source: 1, Target: 2, Latency: 10},
+				{Source: 1, Target: 2, Latency: 20},
+				{Source: 1, Target: 2, Latency: 30},
+				{Source: 1, Target: 2, Timeout: true},
+				{Source: 2, Target: 1, Latency: 5},
+			}
+			Ω(pings.Save(db)).Should(Succeed())
+		})
+
+		It("should aggregate latencies per source and target pair", func() {
+			stats, err := FetchLatencyStats(db, StatsQuery{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(stats).Should(HaveLen(2))
+
+			pair := stats[0]
+			Ω(pair.Source).Should(Equal(int64(1)))
+			Ω(pair.Target).Should(Equal(int64(2)))
+			Ω(pair.Count).Should(Equal(int64(4)))
+			Ω(pair.Timeouts).Should(Equal(int64(1)))
+			Ω(pair.TimeoutRate).Should(BeNumerically("~", 0.25))
+			Ω(pair.Min).Should(BeNumerically("~", 10))
+			Ω(pair.Max).Should(BeNumerically("~", 30))
+			Ω(pair.Mean).Should(BeNumerically("~", 20))
+			Ω(pair.StdDev).Should(BeNumerically("~", 10))
+			Ω(pair.P50).Should(BeNumerically("~", 20))
+		})
+
+		It("should compute a latency matrix between all nodes", func() {
+			node := &Node{Name: "athena"}
+			_, err := node.Save(db)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			matrix, err := FetchLatencyMatrix(db, StatsQuery{Source: 2})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(matrix.Nodes).Should(HaveLen(3))
+			Ω(matrix.Cells).Should(HaveLen(3))
+			Ω(matrix.Nodes[0].Name).Should(Equal("apollo"))
+
+			Ω(matrix.Cells[0][1].Count).Should(Equal(int64(4)))
+			Ω(matrix.Cells[0][1].Median).Should(BeNumerically("~", 20))
+			Ω(matrix.Cells[0][1].TimeoutRate).Should(BeNumerically("~", 0.25))
+			Ω(matrix.Cells[1][0].Count).Should(Equal(int64(1)))
+			Ω(matrix.Cells[2][0].Count).Should(BeZero())
+		})
+
+		It("should compute a time-bucketed latency series", func() {
+			query := SeriesQuery{StatsQuery{Source: 1, From: time.Now().Add(-time.Hour), To: time.Now()}, 24 * time.Hour}
+			series, err := FetchLatencySeries(db, query)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(series.Bucket).Should(Equal("24h0m0s"))
+			Ω(series.Buckets).ShouldNot(BeEmpty())
+
+			var count int64
+			for _, bucket := range series.Buckets {
+				count += bucket.Count
+				Ω(bucket.Time.Unix() % 86400).Should(BeZero())
+			}
+			Ω(count).Should(Equal(int64(4)))
+		})
+
+		It("should only aggregate pings in the time window", func() {
+			stats, err := FetchLatencyStats(db, StatsQuery{To: time.Now().Add(-time.Hour)})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(stats).Should(HaveLen(0))
+		})
+
+	})
+
+})
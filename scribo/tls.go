@@ -0,0 +1,76 @@
+package scribo
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoadTLSConfig returns the TLS configuration for serving HTTPS with the
+// configured certificate and private key, or nil if TLS is not configured.
+func (app *App) LoadTLSConfig() (*tls.Config, error) {
+	if !app.Config.TLS() {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(app.Config.TLSCert, app.Config.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not load TLS certificate: %s", err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// StrictTransport is a decorator for http handlers that adds the HSTS header
+// to responses, so that browsers only connect to the server over HTTPS.
+func StrictTransport(app *App, inner http.Handler) http.Handler {
+	value := fmt.Sprintf("max-age=%d", int64(app.Config.HSTSMaxAge/time.Second))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.Config.HSTSMaxAge > 0 {
+			w.Header().Set("Strict-Transport-Security", value)
+		}
+
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// RedirectHTTPS is a handler for plain HTTP requests that redirects GET and
+// HEAD requests to the same URL on the HTTPS port. Any other request is
+// refused rather than redirected, since its (possibly signed) body has
+// already been sent in the clear and clients should be fixed to use HTTPS.
+func RedirectHTTPS(app *App) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != GET && r.Method != http.MethodHead {
+			app.JSONError(w, errors.New("HTTPS is required"), http.StatusForbidden)
+			return
+		}
+
+		// Hosts without a port may still be bracketed IPv6 addresses.
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+
+		switch {
+		case app.Config.Port != 443:
+			host = net.JoinHostPort(host, strconv.Itoa(app.Config.Port))
+		case strings.Contains(host, ":"):
+			host = "[" + host + "]"
+		}
+
+		url := *r.URL
+		url.Scheme = "https"
+		url.Host = host
+
+		http.Redirect(w, r, url.String(), http.StatusMovedPermanently)
+	})
+}
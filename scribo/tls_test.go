@@ -0,0 +1,220 @@
+package scribo_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	. "github.com/bbengfort/scribo/scribo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TLS", func() {
+
+	var dir string
+	var conf *Config
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "scribo-tls")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		conf = DefaultConfig()
+		conf.DatabaseURL = os.Getenv("TEST_DATABASE_URL")
+		conf.MasterKey = testMasterKey
+		conf.TLSCert, conf.TLSKey = generateCertificate(dir)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should require both a certificate and a key", func() {
+		Ω(conf.Validate()).Should(Succeed())
+
+		conf.TLSKey = ""
+		Ω(conf.TLS()).Should(BeTrue())
+		Ω(conf.Validate()).ShouldNot(Succeed())
+	})
+
+	It("should only redirect to HTTPS if TLS is configured", func() {
+		conf.RedirectPort = 8080
+		Ω(conf.Validate()).Should(Succeed())
+
+		conf.RedirectPort = conf.Port
+		Ω(conf.Validate()).ShouldNot(Succeed())
+
+		conf.RedirectPort = 8080
+		conf.TLSCert, conf.TLSKey = "", ""
+		Ω(conf.Validate()).ShouldNot(Succeed())
+	})
+
+	It("should not load an invalid certificate", func() {
+		app := &App{Config: conf}
+		conf.TLSCert = conf.TLSKey
+
+		_, err := app.LoadTLSConfig()
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should add the HSTS header to responses", func() {
+		app := &App{Config: conf}
+		conf.HSTSMaxAge = 24 * time.Hour
+
+		request, _ := http.NewRequest(GET, "/", nil)
+		response := httptest.NewRecorder()
+		StrictTransport(app, staticHandler(http.StatusOK, nil)).ServeHTTP(response, request)
+		Ω(response.Header().Get("Strict-Transport-Security")).Should(Equal("max-age=86400"))
+
+		conf.HSTSMaxAge = 0
+		response = httptest.NewRecorder()
+		StrictTransport(app, staticHandler(http.StatusOK, nil)).ServeHTTP(response, request)
+		Ω(response.Header().Get("Strict-Transport-Security")).Should(BeEmpty())
+	})
+
+	Describe("redirecting to HTTPS", func() {
+
+		It("should redirect GET requests to the HTTPS port", func() {
+			app := &App{Config: conf}
+
+			request, _ := http.NewRequest(GET, "http://example.com:8080/pings?limit=5", nil)
+			response := httptest.NewRecorder()
+			RedirectHTTPS(app).ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusMovedPermanently))
+			Ω(response.Header().Get("Location")).Should(Equal("https://example.com:5356/pings?limit=5"))
+
+			conf.Port = 443
+			response = httptest.NewRecorder()
+			RedirectHTTPS(app).ServeHTTP(response, request)
+			Ω(response.Header().Get("Location")).Should(Equal("https://example.com/pings?limit=5"))
+		})
+
+		It("should redirect requests to IPv6 hosts", func() {
+			app := &App{Config: conf}
+
+			for _, host := range []string{"[::1]", "[::1]:8080"} {
+				request, _ := http.NewRequest(GET, "/pings", nil)
+				request.Host = host
+
+				conf.Port = 5356
+				response := httptest.NewRecorder()
+				RedirectHTTPS(app).ServeHTTP(response, request)
+				Ω(response.Code).Should(Equal(http.StatusMovedPermanently))
+				Ω(response.Header().Get("Location")).Should(Equal("https://[::1]:5356/pings"))
+
+				conf.Port = 443
+				response = httptest.NewRecorder()
+				RedirectHTTPS(app).ServeHTTP(response, request)
+				Ω(response.Header().Get("Location")).Should(Equal("https://[::1]/pings"))
+			}
+		})
+
+		It("should refuse to redirect requests with a body", func() {
+			app := &App{Config: conf}
+
+			request, _ := http.NewRequest(POST, "http://example.com/pings", nil)
+			response := httptest.NewRecorder()
+			RedirectHTTPS(app).ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusForbidden))
+			Ω(response.Header().Get("Location")).Should(BeEmpty())
+		})
+
+	})
+
+	It("should serve requests over HTTPS", func() {
+		server, err := CreateApp(conf)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		stop := make(chan os.Signal, 1)
+		done := make(chan error, 1)
+		go func() {
+			done <- server.Serve(listener, stop)
+		}()
+
+		// Trust the self-signed certificate in the client
+		data, err := ioutil.ReadFile(conf.TLSCert)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		roots := x509.NewCertPool()
+		Ω(roots.AppendCertsFromPEM(data)).Should(BeTrue())
+
+		client := &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+		}
+
+		response, err := client.Get("https://" + listener.Addr().String() + "/assets/js/scribo.js")
+		Ω(err).ShouldNot(HaveOccurred())
+		response.Body.Close()
+
+		Ω(response.StatusCode).Should(Equal(http.StatusOK))
+		Ω(response.TLS).ShouldNot(BeNil())
+		Ω(response.Header.Get("Strict-Transport-Security")).ShouldNot(BeEmpty())
+
+		// Plain HTTP requests should not be served on the HTTPS port
+		response, err = http.Get("http://" + listener.Addr().String() + "/assets/js/scribo.js")
+		if err == nil {
+			response.Body.Close()
+			Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+		}
+
+		stop <- syscall.SIGTERM
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+})
+
+// Helper function that writes a self-signed certificate and private key for
+// localhost to the directory, returning the paths of the cert and key files.
+func generateCertificate(dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"Scribo Test"}},
+		NotBefore:    time.Now().Add(-1 * time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	der, err := x509.MarshalECPrivateKey(key)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})
+	Ω(ioutil.WriteFile(certPath, certPEM, 0644)).Should(Succeed())
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	Ω(ioutil.WriteFile(keyPath, keyPEM, 0600)).Should(Succeed())
+
+	return certPath, keyPath
+}
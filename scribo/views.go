@@ -1,21 +1,29 @@
 package scribo
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 // Missing status codes that aren't supplied by net/http
 const (
+	StatusMultiStatus         = 207
 	StatusUnprocessableEntity = 422
 )
 
+// MaxBatchSize is the largest body in bytes of a batch of pings (10 MB).
+const MaxBatchSize = 10485760
+
 // Index handles the root route by rendering a small web page that uses the
 // API to display information about the ping status.
 func Index(app *App) http.HandlerFunc {
@@ -36,6 +44,19 @@ func Index(app *App) http.HandlerFunc {
 			return
 		}
 
+		window := StatsQuery{From: time.Now().Add(-DefaultWindow), To: time.Now()}
+		dashboard.Matrix, err = FetchLatencyMatrix(app.DB, window)
+		if err != nil {
+			app.Error(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		dashboard.Series, err = FetchLatencySeries(app.DB, SeriesQuery{window, DefaultBucket})
+		if err != nil {
+			app.Error(w, err, http.StatusInternalServerError)
+			return
+		}
+
 		// Render the template with the dashboard context
 		err = app.Templates.ExecuteTemplate(w, "index", dashboard)
 		if err != nil {
@@ -49,6 +70,7 @@ type (
 	// NodeCollection is a RESTful resource for listing and creating nodes.
 	NodeCollection struct {
 		PutNotSupported
+		PatchNotSupported
 		DeleteNotSupported
 	}
 
@@ -60,6 +82,7 @@ type (
 	// PingCollection is a RESTful resource for listing and creating pings.
 	PingCollection struct {
 		PutNotSupported
+		PatchNotSupported
 		DeleteNotSupported
 	}
 
@@ -67,17 +90,134 @@ type (
 	PingDetail struct {
 		PostNotSupported
 	}
+
+	// PingBatch is a RESTful resource for creating many pings at once.
+	PingBatch struct {
+		GetNotSupported
+		PutNotSupported
+		PatchNotSupported
+		DeleteNotSupported
+	}
+
+	// LatencyStatistics is a read-only resource for aggregate latencies.
+	LatencyStatistics struct {
+		PostNotSupported
+		PutNotSupported
+		PatchNotSupported
+		DeleteNotSupported
+	}
+
+	// NetworkMatrix is a read-only resource for the latency between all nodes.
+	NetworkMatrix struct {
+		PostNotSupported
+		PutNotSupported
+		PatchNotSupported
+		DeleteNotSupported
+	}
+
+	// PingSeries is a read-only resource for time-bucketed ping aggregates.
+	PingSeries struct {
+		PostNotSupported
+		PutNotSupported
+		PatchNotSupported
+		DeleteNotSupported
+	}
+
+	// EnrollmentTokenCollection is a RESTful resource for listing and
+	// creating enrollment tokens.
+	EnrollmentTokenCollection struct {
+		PutNotSupported
+		PatchNotSupported
+		DeleteNotSupported
+	}
+
+	// EnrollmentResource is an unauthenticated resource where new nodes
+	// exchange an enrollment token for their credentials.
+	EnrollmentResource struct {
+		GetNotSupported
+		PutNotSupported
+		PatchNotSupported
+		DeleteNotSupported
+	}
 )
 
-// Get returns the listing of nodes
+// Permissions allows every node to list nodes but only admins to create them.
+func (r NodeCollection) Permissions() Permissions {
+	return Permissions{GET: Roles}
+}
+
+// Permissions allows every node to get a node but only admins to change it.
+func (r NodeDetail) Permissions() Permissions {
+	return Permissions{GET: Roles}
+}
+
+// Permissions allows every node to list pings and reporters to create them.
+func (r PingCollection) Permissions() Permissions {
+	return Permissions{GET: Roles, POST: {RoleReporter}}
+}
+
+// Permissions allows every node to get a ping but only admins to change it.
+func (r PingDetail) Permissions() Permissions {
+	return Permissions{GET: Roles}
+}
+
+// Permissions allows reporters to create batches of pings.
+func (r PingBatch) Permissions() Permissions {
+	return Permissions{POST: {RoleReporter}}
+}
+
+// Permissions allows every node to read the latency statistics.
+func (r LatencyStatistics) Permissions() Permissions {
+	return Permissions{GET: Roles}
+}
+
+// Permissions allows every node to read the network matrix.
+func (r NetworkMatrix) Permissions() Permissions {
+	return Permissions{GET: Roles}
+}
+
+// Permissions allows every node to read the ping series.
+func (r PingSeries) Permissions() Permissions {
+	return Permissions{GET: Roles}
+}
+
+// Permissions allows only admins to list and create enrollment tokens.
+func (r EnrollmentTokenCollection) Permissions() Permissions {
+	return Permissions{}
+}
+
+// Permissions allows new nodes to enroll without signing their requests.
+func (r EnrollmentResource) Permissions() Permissions {
+	return Permissions{POST: {Anonymous}}
+}
+
+// Get returns a page of the listing of nodes, filtered by the query.
 func (r NodeCollection) Get(app *App, request *http.Request) (int, interface{}, error) {
-	nodes, err := FetchNodes(app.DB, 10)
+	query, err := ParseNodeQuery(request)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	nodes, err := QueryNodes(app.DB, query)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
 
+	total, err := CountNodes(app.DB, query)
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
 	}
 
-	return http.StatusOK, nodes, nil
+	if nodes == nil {
+		nodes = Nodes{}
+	}
+
+	page := Page{Count: len(nodes), Total: &total, Items: nodes}
+	if offset := query.Offset + len(nodes); int64(offset) < total && len(nodes) > 0 {
+		page.Next = nextPageURL(request, "offset", strconv.Itoa(offset))
+	}
+
+	return http.StatusOK, page, nil
 }
 
 // Post handles the creation of a node from JSON in the request body
@@ -113,7 +253,7 @@ func (r NodeCollection) Post(app *App, request *http.Request) (int, interface{},
 	// Handle the creation conditions
 	switch {
 	case dberr != nil:
-		return http.StatusConflict, nil, dberr
+		return http.StatusInternalServerError, nil, dberr
 	default:
 		return http.StatusCreated, node, nil
 	}
@@ -122,58 +262,34 @@ func (r NodeCollection) Post(app *App, request *http.Request) (int, interface{},
 
 // Get returns a single node from the database.
 func (r NodeDetail) Get(app *App, request *http.Request) (int, interface{}, error) {
-	// Parse the variables from the URL route.
-	vars := mux.Vars(request)
-	nodeID, err := strconv.ParseInt(vars["ID"], 0, 64)
+	// Parse the ID from the URL route (404 if it isn't a number).
+	nodeID, err := routeID(request, "node")
 
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
 	}
 
-	// Query the database for the node by the ID.
+	// Query the database for the node by the ID (404 if it doesn't exist).
 	node, err := GetNode(app.DB, nodeID)
 	if err != nil {
-		return http.StatusNotFound, nil, err
+		return http.StatusInternalServerError, nil, err
 	}
 
 	return http.StatusOK, node, nil
 }
 
-// Put updates a node in the database
+// Put replaces the updateable fields of a node in the database. Fields that
+// are missing from the request are reset to their zero values; use Patch to
+// update only some of the fields of the node.
 func (r NodeDetail) Put(app *App, request *http.Request) (int, interface{}, error) {
-	// Parse the variables from the URL route.
-	vars := mux.Vars(request)
-	nodeID, err := strconv.ParseInt(vars["ID"], 0, 64)
-
+	node, body, err := readNodeUpdate(app, request)
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
 	}
 
-	// Query the database for the node by the ID.
-	node, err := GetNode(app.DB, nodeID)
-	if err != nil {
-		return http.StatusNotFound, nil, err
-	}
-
-	// Now perform the update ...
-	// Read the data from the request stream (limit the size to 1 MB)
-	body, err := ioutil.ReadAll(io.LimitReader(request.Body, 1048576))
-
-	// Todo return a 413 (entity too large) if it's the limit that's reached.
-	if err != nil {
-		return http.StatusInternalServerError, nil, err
-	}
-
-	// Attempt to close the body of the request for reading
-	if err := request.Body.Close(); err != nil {
-		return http.StatusInternalServerError, nil, err
-	}
-
-	// Create a temporary node to  unmarshall data to.
-	var fields map[string]interface{}
-
-	// Unmarshal the Put into a Node struct
-	if err := json.Unmarshal(body, &fields); err != nil {
+	// Unmarshal the Put into a replacement Node struct
+	var replacement Node
+	if err := json.Unmarshal(body, &replacement); err != nil {
 		// If JSON parsing fails send back a 422 "unprocessable entity"
 		response := make(map[string]string)
 		response["code"] = strconv.Itoa(StatusUnprocessableEntity)
@@ -182,70 +298,100 @@ func (r NodeDetail) Put(app *App, request *http.Request) (int, interface{}, erro
 		return StatusUnprocessableEntity, response, nil
 	}
 
-	// Update the node with the fields that are updateable.
-	if val, ok := fields["name"]; ok {
-		node.Name = val.(string)
+	// Replace the fields that are updateable. The role is only replaced if
+	// it is specified so that clients that predate roles don't demote nodes.
+	node.Name = replacement.Name
+	node.Address = replacement.Address
+	node.DNS = replacement.DNS
+
+	if replacement.Role != "" {
+		node.Role = replacement.Role
 	}
 
-	if val, ok := fields["address"]; ok {
-		node.Address = val.(string)
+	// Save the node updates in the database
+	if _, err := node.Save(app.DB); err != nil {
+		return http.StatusInternalServerError, nil, err
 	}
 
-	if val, ok := fields["dns"]; ok {
-		node.DNS = val.(string)
+	return http.StatusOK, node, nil
+}
+
+// Patch updates some of the fields of a node in the database from a JSON
+// Merge Patch in the request body.
+func (r NodeDetail) Patch(app *App, request *http.Request) (int, interface{}, error) {
+	node, body, err := readNodeUpdate(app, request)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
 	}
 
-	// Save the node updates in the database
-	_, dberr := node.Save(app.DB)
+	var patch NodePatch
+	if err := DecodeMergePatch(body, &patch); err != nil {
+		return StatusUnprocessableEntity, nil, err
+	}
 
-	// Handle the creation conditions
-	switch {
-	case dberr != nil:
-		return http.StatusConflict, nil, dberr
-	default:
-		return http.StatusOK, node, nil
+	patch.Apply(&node)
+
+	// Save the node updates in the database
+	if _, err := node.Save(app.DB); err != nil {
+		return http.StatusInternalServerError, nil, err
 	}
 
+	return http.StatusOK, node, nil
 }
 
 // Delete a node from the database
 func (r NodeDetail) Delete(app *App, request *http.Request) (int, interface{}, error) {
-	// Parse the variables from the URL route.
-	vars := mux.Vars(request)
-	nodeID, err := strconv.ParseInt(vars["ID"], 0, 64)
+	// Parse the ID from the URL route (404 if it isn't a number).
+	nodeID, err := routeID(request, "node")
 
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
 	}
 
-	// Query the database for the node by the ID.
+	// Query the database for the node by the ID (404 if it doesn't exist).
 	node, err := GetNode(app.DB, nodeID)
 	if err != nil {
-		return http.StatusNotFound, nil, err
+		return http.StatusInternalServerError, nil, err
 	}
 
 	// Delete the Node from the database
-	deleted, err := node.Delete(app.DB)
-
-	switch {
-	case err != nil:
+	if _, err := node.Delete(app.DB); err != nil {
 		return http.StatusInternalServerError, nil, err
-	case !deleted:
-		return http.StatusConflict, nil, errors.New("Unable to delete node!")
-	default:
-		return http.StatusNoContent, nil, nil
 	}
+
+	return http.StatusNoContent, nil, nil
 }
 
-// Get returns the listing of pings
+// Get returns a page of the listing of pings, filtered by the query.
 func (r PingCollection) Get(app *App, request *http.Request) (int, interface{}, error) {
-	pings, err := FetchPings(app.DB, 10)
+	query, err := ParsePingQuery(request)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	// Fetch one more ping than requested to determine if there is a next page.
+	limit := query.Limit
+	query.Limit++
 
+	pings, err := QueryPings(app.DB, query)
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
 	}
 
-	return http.StatusOK, pings, nil
+	page := Page{}
+	if len(pings) > limit {
+		pings = pings[:limit]
+		cursor := strconv.FormatInt(pings[limit-1].ID, 10)
+		page.Next = nextPageURL(request, "after", cursor)
+	}
+
+	if pings == nil {
+		pings = Pings{}
+	}
+
+	page.Count = len(pings)
+	page.Items = pings
+	return http.StatusOK, page, nil
 }
 
 // Post handles the creation of a ping from JSON in the request body
@@ -275,58 +421,304 @@ func (r PingCollection) Post(app *App, request *http.Request) (int, interface{},
 		return StatusUnprocessableEntity, response, nil
 	}
 
+	// Ensure the ping is reported by the node that signed the request
+	if err := bindPingSource(request, &ping); err != nil {
+		return http.StatusForbidden, nil, err
+	}
+
 	// Create the ping in the database
 	_, dberr := ping.Save(app.DB)
 
 	// Handle the creation conditions
 	switch {
 	case dberr != nil:
-		return http.StatusConflict, nil, dberr
+		return http.StatusInternalServerError, nil, dberr
 	default:
+		app.Metrics.ObservePings(pingSource(ping), ping)
 		return http.StatusCreated, ping, nil
 	}
 }
 
 // Get returns a single ping from the database.
 func (r PingDetail) Get(app *App, request *http.Request) (int, interface{}, error) {
-	// Parse the variables from the URL route.
-	vars := mux.Vars(request)
-	pingID, err := strconv.ParseInt(vars["ID"], 0, 64)
+	// Parse the ID from the URL route (404 if it isn't a number).
+	pingID, err := routeID(request, "ping")
 
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
 	}
 
-	// Query the database for the ping by the ID.
+	// Query the database for the ping by the ID (404 if it doesn't exist).
 	ping, err := GetPing(app.DB, pingID)
 	if err != nil {
-		return http.StatusNotFound, nil, err
+		return http.StatusInternalServerError, nil, err
 	}
 
 	return http.StatusOK, ping, nil
 }
 
-// Put updates a ping in the database
+// Put replaces the updateable fields of a ping in the database. Fields that
+// are missing from the request are reset to their zero values; use Patch to
+// update only some of the fields of the ping.
 func (r PingDetail) Put(app *App, request *http.Request) (int, interface{}, error) {
-	// Parse the variables from the URL route.
-	vars := mux.Vars(request)
-	pingID, err := strconv.ParseInt(vars["ID"], 0, 64)
+	ping, body, err := readPingUpdate(app, request)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	// Unmarshal the Put into a replacement Ping struct
+	var replacement Ping
+	if err := json.Unmarshal(body, &replacement); err != nil {
+		// If JSON parsing fails send back a 422 "unprocessable entity"
+		response := make(map[string]string)
+		response["code"] = strconv.Itoa(StatusUnprocessableEntity)
+		response["reason"] = "Could not parse JSON into a Ping object."
+		response["error"] = err.Error()
+		return StatusUnprocessableEntity, response, nil
+	}
+
+	// Replace the fields that are updateable.
+	ping.Source = replacement.Source
+	ping.Target = replacement.Target
+	ping.Payload = replacement.Payload
+	ping.Latency = replacement.Latency
+	ping.Timeout = replacement.Timeout
+
+	// Save the ping updates in the database
+	if _, err := ping.Save(app.DB); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	return http.StatusOK, ping, nil
+}
+
+// Patch updates some of the fields of a ping in the database from a JSON
+// Merge Patch in the request body.
+func (r PingDetail) Patch(app *App, request *http.Request) (int, interface{}, error) {
+	ping, body, err := readPingUpdate(app, request)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	var patch PingPatch
+	if err := DecodeMergePatch(body, &patch); err != nil {
+		return StatusUnprocessableEntity, nil, err
+	}
+
+	patch.Apply(&ping)
+
+	// Save the ping updates in the database
+	if _, err := ping.Save(app.DB); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	return http.StatusOK, ping, nil
+}
+
+// Delete a ping from the database
+func (r PingDetail) Delete(app *App, request *http.Request) (int, interface{}, error) {
+	// Parse the ID from the URL route (404 if it isn't a number).
+	pingID, err := routeID(request, "ping")
 
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
 	}
 
-	// Query the database for the ping by the ID.
+	// Query the database for the ping by the ID (404 if it doesn't exist).
 	ping, err := GetPing(app.DB, pingID)
 	if err != nil {
-		return http.StatusNotFound, nil, err
+		return http.StatusInternalServerError, nil, err
 	}
 
-	// Now perform the update ...
-	// Read the data from the request stream (limit the size to 1 MB)
-	body, err := ioutil.ReadAll(io.LimitReader(request.Body, 1048576))
+	// Delete the Ping from the database
+	if _, err := ping.Delete(app.DB); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
 
-	// Todo return a 413 (entity too large) if it's the limit that's reached.
+	return http.StatusNoContent, nil, nil
+}
+
+// Get returns the latency statistics for every source and target pair that
+// has pings in the time window specified by the query.
+func (r LatencyStatistics) Get(app *App, request *http.Request) (int, interface{}, error) {
+	query, err := ParseStatsQuery(request)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	stats, err := FetchLatencyStats(app.DB, query)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	return http.StatusOK, stats, nil
+}
+
+// Get returns the latency matrix between all registered nodes for the pings
+// in the time window specified by the query, by default the last day.
+func (r NetworkMatrix) Get(app *App, request *http.Request) (int, interface{}, error) {
+	query, err := ParseMatrixQuery(request)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	matrix, err := FetchLatencyMatrix(app.DB, query)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	return http.StatusOK, matrix, nil
+}
+
+// Get returns the time series of latency summaries for the pings between the
+// source and target in the window specified by the query.
+func (r PingSeries) Get(app *App, request *http.Request) (int, interface{}, error) {
+	query, err := ParseSeriesQuery(request)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	series, err := FetchLatencySeries(app.DB, query)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	return http.StatusOK, series, nil
+}
+
+// Get returns all of the enrollment tokens and whether they have been used.
+func (r EnrollmentTokenCollection) Get(app *App, request *http.Request) (int, interface{}, error) {
+	tokens, err := FetchEnrollmentTokens(app.DB)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	if tokens == nil {
+		tokens = []EnrollmentToken{}
+	}
+
+	return http.StatusOK, tokens, nil
+}
+
+// Post creates an enrollment token from the optional role and ttl (e.g. 24h)
+// in the JSON request body. The response is the only time that the token is
+// available.
+func (r EnrollmentTokenCollection) Post(app *App, request *http.Request) (int, interface{}, error) {
+	body, err := readRequestBody(request)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	var params struct {
+		Role string `json:"role"`
+		TTL  string `json:"ttl"`
+	}
+
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &params); err != nil {
+			response := make(map[string]string)
+			response["code"] = strconv.Itoa(StatusUnprocessableEntity)
+			response["reason"] = "Could not parse JSON into an enrollment token."
+			response["error"] = err.Error()
+			return StatusUnprocessableEntity, response, nil
+		}
+	}
+
+	var ttl time.Duration
+	if params.TTL != "" {
+		if ttl, err = time.ParseDuration(params.TTL); err != nil {
+			return StatusUnprocessableEntity, nil, &ValidationError{Field: "ttl", Reason: "must be a duration such as 24h"}
+		}
+	}
+
+	token, err := CreateEnrollmentToken(app.DB, params.Role, ttl)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	return http.StatusCreated, token, nil
+}
+
+// Post exchanges the enrollment token in the JSON request body for the
+// credentials of a new node with the name, address, and DNS in the body.
+func (r EnrollmentResource) Post(app *App, request *http.Request) (int, interface{}, error) {
+	body, err := readRequestBody(request)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	var enrollment Enrollment
+	if err := json.Unmarshal(body, &enrollment); err != nil {
+		response := make(map[string]string)
+		response["code"] = strconv.Itoa(StatusUnprocessableEntity)
+		response["reason"] = "Could not parse JSON into an enrollment."
+		response["error"] = err.Error()
+		return StatusUnprocessableEntity, response, nil
+	}
+
+	if app.Keys == nil {
+		return http.StatusInternalServerError, nil, errors.New("cannot enroll nodes without a master key")
+	}
+
+	credentials, err := Enroll(app.DB, app.Keys, enrollment)
+	switch {
+	case err == ErrInvalidEnrollmentToken:
+		return http.StatusForbidden, nil, err
+	case err != nil:
+		return http.StatusInternalServerError, nil, err
+	}
+
+	app.Log.Infof("enrolled node %q as %s", credentials.Node.Name, credentials.Node.Role)
+	return http.StatusCreated, credentials, nil
+}
+
+// Helper function that binds the source of a ping to the node that signed
+// the request. Pings without a source are attributed to the signing node and
+// pings that claim to be from any other node are rejected.
+func bindPingSource(request *http.Request, ping *Ping) error {
+	node, ok := AuthenticatedNode(request)
+	if !ok {
+		return nil
+	}
+
+	switch ping.Source {
+	case 0:
+		ping.Source = node.ID
+		return nil
+	case node.ID:
+		return nil
+	default:
+		return fmt.Errorf("node %q cannot report pings from source %d", node.Name, ping.Source)
+	}
+}
+
+// BatchResult reports the outcome of creating a single item in a batch. The
+// index refers to the position of the item in the uploaded array or stream.
+type BatchResult struct {
+	Index  int    `json:"index"`           // Position of the item in the batch
+	Status int    `json:"status"`          // HTTP status code for the item
+	ID     int64  `json:"id,omitempty"`    // ID of the created item
+	Error  string `json:"error,omitempty"` // Reason the item was not created
+
+	// Reason each field of the item is invalid
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// BatchResponse summarizes the per-item results of a batch upload.
+type BatchResponse struct {
+	Created int           `json:"created"` // Number of items created
+	Failed  int           `json:"failed"`  // Number of items not created
+	Results []BatchResult `json:"results"` // Outcome of each item in order
+}
+
+// Post handles the creation of many pings from either a JSON array or a
+// newline delimited JSON stream in the request body. Pings that cannot be
+// parsed, are invalid, or that refer to unknown nodes are reported as failures
+// while the remainder of the batch is inserted in a single transaction.
+func (r PingBatch) Post(app *App, request *http.Request) (int, interface{}, error) {
+	// Read the data from the request stream (limit the size to 10 MB), reading
+	// one more byte than the limit so that larger batches aren't truncated.
+	body, err := ioutil.ReadAll(io.LimitReader(request.Body, MaxBatchSize+1))
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
 	}
@@ -336,77 +728,224 @@ func (r PingDetail) Put(app *App, request *http.Request) (int, interface{}, erro
 		return http.StatusInternalServerError, nil, err
 	}
 
-	// Create a temporary node to  unmarshall data to.
-	var fields map[string]interface{}
+	if len(body) > MaxBatchSize {
+		return http.StatusRequestEntityTooLarge, nil, fmt.Errorf("the batch is larger than %d bytes", MaxBatchSize)
+	}
 
-	// Unmarshal the Put into a Node struct
-	if err := json.Unmarshal(body, &fields); err != nil {
-		// If JSON parsing fails send back a 422 "unprocessable entity"
+	// Decode the batch into pings with a result for every item.
+	pings, results, err := decodePingBatch(body)
+	if err != nil {
 		response := make(map[string]string)
 		response["code"] = strconv.Itoa(StatusUnprocessableEntity)
-		response["reason"] = "Could not parse JSON into a Ping object."
+		response["reason"] = "Could not parse JSON into a batch of Ping objects."
 		response["error"] = err.Error()
 		return StatusUnprocessableEntity, response, nil
 	}
 
-	// Update the node with the fields that are updateable.
-	if val, ok := fields["source"]; ok {
-		ping.Source = val.(int64)
+	// Bind the source of each ping to the signing node and validate it.
+	for idx := range pings {
+		if results[idx].Status != 0 {
+			continue
+		}
+
+		ping := &pings[idx]
+		if err := bindPingSource(request, ping); err != nil {
+			results[idx].Status = http.StatusForbidden
+			results[idx].Error = err.Error()
+			continue
+		}
+
+		if err := ping.Validate(); err != nil {
+			results[idx].Status = StatusUnprocessableEntity
+			results[idx].Error = err.Error()
+			results[idx].Fields = validationFields(err)
+		}
+	}
+
+	// Check that every ping refers to nodes that exist, otherwise the deferred
+	// foreign key constraints will abort the entire transaction on commit.
+	var refs []int64
+	for idx, ping := range pings {
+		if results[idx].Status == 0 {
+			refs = append(refs, ping.Source, ping.Target)
+		}
 	}
 
-	if val, ok := fields["target"]; ok {
-		ping.Target = val.(int64)
+	nodes, err := FetchNodeIDs(app.DB, refs...)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
 	}
 
-	if val, ok := fields["payload"]; ok {
-		ping.Payload = val.(int)
+	var batch Pings
+	var indices []int
+
+	for idx, ping := range pings {
+		if results[idx].Status != 0 {
+			continue
+		}
+
+		switch {
+		case !nodes[ping.Source]:
+			err := &ValidationError{Field: "source", Reason: fmt.Sprintf("unknown source node %d", ping.Source)}
+			results[idx].Status = StatusUnprocessableEntity
+			results[idx].Error = err.Reason
+			results[idx].Fields = validationFields(err)
+		case !nodes[ping.Target]:
+			err := &ValidationError{Field: "target", Reason: fmt.Sprintf("unknown target node %d", ping.Target)}
+			results[idx].Status = StatusUnprocessableEntity
+			results[idx].Error = err.Reason
+			results[idx].Fields = validationFields(err)
+		default:
+			batch = append(batch, ping)
+			indices = append(indices, idx)
+		}
 	}
 
-	if val, ok := fields["latency"]; ok {
-		ping.Latency = val.(float64)
+	// Insert the valid pings into the database in a single transaction.
+	if err := batch.Save(app.DB); err != nil {
+		return http.StatusInternalServerError, nil, err
 	}
 
-	if val, ok := fields["timeout"]; ok {
-		ping.Timeout = val.(bool)
+	for i, ping := range batch {
+		results[indices[i]].Status = http.StatusCreated
+		results[indices[i]].ID = ping.ID
+		app.Metrics.ObservePings(pingSource(ping), ping)
 	}
 
-	// Save the node updates in the database
-	_, dberr := ping.Save(app.DB)
+	response := BatchResponse{Created: len(batch), Failed: len(results) - len(batch), Results: results}
 
-	// Handle the creation conditions
 	switch {
-	case dberr != nil:
-		return http.StatusConflict, nil, dberr
+	case response.Failed == 0:
+		return http.StatusCreated, response, nil
+	case response.Created == 0:
+		return StatusUnprocessableEntity, response, nil
 	default:
-		return http.StatusOK, ping, nil
+		return StatusMultiStatus, response, nil
 	}
 }
 
-// Delete a ping from the database
-func (r PingDetail) Delete(app *App, request *http.Request) (int, interface{}, error) {
-	// Parse the variables from the URL route.
+// Helper function that decodes a batch of pings from a JSON array or from a
+// newline delimited JSON stream. A result is returned for every item in the
+// batch; items that could not be parsed have their status and error set. An
+// error is only returned if the batch as a whole is malformed or empty.
+func decodePingBatch(body []byte) (Pings, []BatchResult, error) {
+	var pings Pings
+	var results []BatchResult
+
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, nil, errors.New("no pings in the batch")
+	}
+
+	// Split the batch into the raw JSON of each of the items.
+	var items []json.RawMessage
+	if body[0] == '[' {
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		scanner.Buffer(make([]byte, 0, 4096), len(body))
+
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			item := make(json.RawMessage, len(line))
+			copy(item, line)
+			items = append(items, item)
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(items) == 0 {
+		return nil, nil, errors.New("no pings in the batch")
+	}
+
+	for idx, item := range items {
+		var ping Ping
+		result := BatchResult{Index: idx}
+
+		if err := json.Unmarshal(item, &ping); err != nil {
+			result.Status = StatusUnprocessableEntity
+			result.Error = err.Error()
+		}
+
+		// Clients cannot specify the ID of a ping they are creating.
+		ping.ID = 0
+
+		pings = append(pings, ping)
+		results = append(results, result)
+	}
+
+	return pings, results, nil
+}
+
+// Helper function that parses the ID of the resource from the URL route. IDs
+// that are not numbers can't identify a record, so a NotFoundError is returned
+// rather than the parse error.
+func routeID(request *http.Request, resource string) (int64, error) {
 	vars := mux.Vars(request)
-	pingID, err := strconv.ParseInt(vars["ID"], 0, 64)
+	id, err := strconv.ParseInt(vars["ID"], 10, 64)
+	if err != nil {
+		return 0, &NotFoundError{Resource: resource, Key: vars["ID"]}
+	}
+	return id, nil
+}
+
+// Helper function that fetches the node identified by the URL and reads the
+// body of the request for updating the node with the Put and Patch methods.
+func readNodeUpdate(app *App, request *http.Request) (Node, []byte, error) {
+	// Parse the ID from the URL route (404 if it isn't a number).
+	nodeID, err := routeID(request, "node")
 
 	if err != nil {
-		return http.StatusInternalServerError, nil, err
+		return Node{}, nil, err
 	}
 
-	// Query the database for the ping by the ID.
+	// Query the database for the node by the ID (404 if it doesn't exist).
+	node, err := GetNode(app.DB, nodeID)
+	if err != nil {
+		return node, nil, err
+	}
+
+	body, err := readRequestBody(request)
+	return node, body, err
+}
+
+// Helper function that fetches the ping identified by the URL and reads the
+// body of the request for updating the ping with the Put and Patch methods.
+func readPingUpdate(app *App, request *http.Request) (Ping, []byte, error) {
+	// Parse the ID from the URL route (404 if it isn't a number).
+	pingID, err := routeID(request, "ping")
+
+	if err != nil {
+		return Ping{}, nil, err
+	}
+
+	// Query the database for the ping by the ID (404 if it doesn't exist).
 	ping, err := GetPing(app.DB, pingID)
 	if err != nil {
-		return http.StatusNotFound, nil, err
+		return ping, nil, err
 	}
 
-	// Delete the Ping from the database
-	deleted, err := ping.Delete(app.DB)
+	body, err := readRequestBody(request)
+	return ping, body, err
+}
 
-	switch {
-	case err != nil:
-		return http.StatusInternalServerError, nil, err
-	case !deleted:
-		return http.StatusConflict, nil, errors.New("Unable to delete ping!")
-	default:
-		return http.StatusNoContent, nil, nil
+// Helper function that reads and closes the body of the request, limiting
+// the size of the body to 1 MB.
+func readRequestBody(request *http.Request) ([]byte, error) {
+	// Todo return a 413 (entity too large) if it's the limit that's reached.
+	body, err := ioutil.ReadAll(io.LimitReader(request.Body, 1048576))
+	if err != nil {
+		return nil, err
 	}
+
+	return body, request.Body.Close()
 }
@@ -1,12 +1,461 @@
 package scribo_test
 
 import (
-	// . "github.com/bbengfort/scribo/scribo"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/bbengfort/scribo/scribo"
+	"github.com/gorilla/mux"
 
 	. "github.com/onsi/ginkgo"
-	// . "github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("Views", func() {
 
+	AfterEach(func() {
+		truncateTables(tables)
+	})
+
+	Describe("PingCollection", func() {
+
+		var handler http.Handler
+
+		BeforeEach(func() {
+			for _, name := range []string{"apollo", "artemis"} {
+				createNode(Node{Name: name}, name+"secretkey")
+			}
+
+			route := CreateResourceRoute(PingCollection{}, "PingCollection", "/pings")
+			handler = Authenticate(app, route.Handler(app))
+		})
+
+		It("should default the source of a ping to the signing node", func() {
+			body := bytes.NewBufferString(`{"target": 2, "latency": 12.3}`)
+			request := signedRequest(POST, "http://localhost:8080/pings", body, "apollo", "apollosecretkey")
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+
+			Ω(response.Code).Should(Equal(http.StatusCreated))
+			Ω(response.Body.String()).Should(ContainSubstring(`"source":1`))
+		})
+
+		It("should report invalid fields in a structured response", func() {
+			body := bytes.NewBufferString(`{"target": 0, "latency": -12.3}`)
+			request := signedRequest(POST, "http://localhost:8080/pings", body, "apollo", "apollosecretkey")
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+
+			Ω(response.Code).Should(Equal(StatusUnprocessableEntity))
+			Ω(response.Body.String()).Should(MatchJSON(`{
+				"code": "422",
+				"error": "invalid target: is required; invalid latency: cannot be negative",
+				"fields": {"target": "is required", "latency": "cannot be negative"}
+			}`))
+		})
+
+		It("should report unknown nodes as invalid fields", func() {
+			body := bytes.NewBufferString(`{"target": 42, "latency": 12.3}`)
+			request := signedRequest(POST, "http://localhost:8080/pings", body, "apollo", "apollosecretkey")
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+
+			Ω(response.Code).Should(Equal(StatusUnprocessableEntity))
+			Ω(response.Body.String()).Should(ContainSubstring(`"fields":{"target"`))
+		})
+
+		It("should reject pings from a source other than the signing node", func() {
+			body := bytes.NewBufferString(`{"source": 2, "target": 1, "latency": 12.3}`)
+			request := signedRequest(POST, "http://localhost:8080/pings", body, "apollo", "apollosecretkey")
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+
+			Ω(response.Code).Should(Equal(http.StatusForbidden))
+		})
+
+	})
+
+	Describe("NodeDetail", func() {
+
+		var router *mux.Router
+
+		BeforeEach(func() {
+			createNode(Node{Name: "apollo", Role: RoleAdmin}, "apollosecretkey")
+
+			route := CreateResourceRoute(NodeDetail{}, "NodeDetail", "/nodes/{ID}")
+			router = mux.NewRouter()
+			router.Handle(route.Pattern, Authenticate(app, route.Handler(app)))
+		})
+
+		It("should return not found for missing nodes", func() {
+			for _, method := range []string{GET, DELETE} {
+				request := signedRequest(method, "http://localhost:8080/nodes/42", nil, "apollo", "apollosecretkey")
+				response := httptest.NewRecorder()
+				router.ServeHTTP(response, request)
+
+				Ω(response.Code).Should(Equal(http.StatusNotFound))
+				Ω(response.Body.String()).Should(ContainSubstring("node 42 not found"))
+			}
+		})
+
+		It("should return not found for node IDs that are not numbers", func() {
+			for _, method := range []string{GET, PUT, PATCH, DELETE} {
+				request := signedRequest(method, "http://localhost:8080/nodes/abc", bytes.NewBufferString(`{"name": "artemis"}`), "apollo", "apollosecretkey")
+				response := httptest.NewRecorder()
+				router.ServeHTTP(response, request)
+
+				Ω(response.Code).Should(Equal(http.StatusNotFound))
+				Ω(response.Body.String()).Should(ContainSubstring("node abc not found"))
+				Ω(response.Body.String()).ShouldNot(ContainSubstring("strconv"))
+			}
+		})
+
+		It("should not delete a node that is referenced by pings", func() {
+			ping := &Ping{Source: 1, Target: 1}
+			_, err := ping.Save(db)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			request := signedRequest(DELETE, "http://localhost:8080/nodes/1", nil, "apollo", "apollosecretkey")
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusConflict))
+		})
+
+	})
+
+	Describe("PingDetail", func() {
+
+		var router *mux.Router
+
+		BeforeEach(func() {
+			createNode(Node{Name: "apollo", Role: RoleAdmin}, "apollosecretkey")
+			createNode(Node{Name: "artemis"}, "artemissecretkey")
+
+			ping := &Ping{Source: 1, Target: 2, Payload: 64, Latency: 12.3}
+			_, err := ping.Save(db)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			route := CreateResourceRoute(PingDetail{}, "PingDetail", "/pings/{ID}")
+			router = mux.NewRouter()
+			router.Handle(route.Pattern, Authenticate(app, route.Handler(app)))
+		})
+
+		It("should patch the source and payload of a ping", func() {
+			body := bytes.NewBufferString(`{"source": 2, "target": 1, "payload": 128}`)
+			request := signedRequest(PATCH, "http://localhost:8080/pings/1", body, "apollo", "apollosecretkey")
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusOK))
+
+			ping, err := GetPing(db, 1)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ping.Source).Should(Equal(int64(2)))
+			Ω(ping.Payload).Should(Equal(128))
+			Ω(ping.Latency).Should(Equal(12.3))
+		})
+
+		It("should replace all of the fields of a ping", func() {
+			body := bytes.NewBufferString(`{"source": 2, "target": 1}`)
+			request := signedRequest(PUT, "http://localhost:8080/pings/1", body, "apollo", "apollosecretkey")
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusOK))
+
+			ping, err := GetPing(db, 1)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ping.Source).Should(Equal(int64(2)))
+			Ω(ping.Payload).Should(BeZero())
+			Ω(ping.Latency).Should(BeZero())
+		})
+
+		It("should not patch a ping with invalid fields", func() {
+			body := bytes.NewBufferString(`{"payload": "big", "latency": -1}`)
+			request := signedRequest(PATCH, "http://localhost:8080/pings/1", body, "apollo", "apollosecretkey")
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+
+			Ω(response.Code).Should(Equal(StatusUnprocessableEntity))
+			Ω(response.Body.String()).Should(ContainSubstring(`"payload":"must be an integer"`))
+		})
+
+	})
+
+	Describe("PingBatch", func() {
+
+		BeforeEach(func() {
+			for _, name := range []string{"apollo", "artemis"} {
+				node := &Node{Name: name}
+				_, err := node.Save(db)
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+		})
+
+		It("should create a JSON array of pings", func() {
+			body := bytes.NewBufferString(`[{"source": 1, "target": 2, "latency": 12.3}, {"source": 2, "target": 1, "latency": 9.8}]`)
+			request, _ := http.NewRequest(POST, "/pings/batch", body)
+
+			code, data, err := PingBatch{}.Post(app, request)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(code).Should(Equal(http.StatusCreated))
+
+			response := data.(BatchResponse)
+			Ω(response.Created).Should(Equal(2))
+			Ω(response.Failed).Should(Equal(0))
+			Ω(response.Results[1].ID).Should(Equal(int64(2)))
+		})
+
+		It("should report partial failures in a NDJSON stream", func() {
+			body := bytes.NewBufferString("{\"source\": 1, \"target\": 2}\n{\"source\": 1, \"target\": 42}\nnot json\n")
+			request, _ := http.NewRequest(POST, "/pings/batch", body)
+
+			code, data, err := PingBatch{}.Post(app, request)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(code).Should(Equal(StatusMultiStatus))
+
+			response := data.(BatchResponse)
+			Ω(response.Created).Should(Equal(1))
+			Ω(response.Failed).Should(Equal(2))
+			Ω(response.Results[0].Status).Should(Equal(http.StatusCreated))
+			Ω(response.Results[1].Status).Should(Equal(StatusUnprocessableEntity))
+			Ω(response.Results[1].Error).Should(ContainSubstring("unknown target"))
+			Ω(response.Results[2].Status).Should(Equal(StatusUnprocessableEntity))
+		})
+
+		It("should refuse a batch that is larger than the limit", func() {
+			body := bytes.NewBufferString("{\"source\": 1, \"target\": 2}\n")
+			body.Write(bytes.Repeat([]byte(" "), MaxBatchSize))
+			request, _ := http.NewRequest(POST, "/pings/batch", body)
+
+			code, _, err := PingBatch{}.Post(app, request)
+			Ω(err).Should(HaveOccurred())
+			Ω(code).Should(Equal(http.StatusRequestEntityTooLarge))
+		})
+
+		It("should reject an empty batch", func() {
+			for _, batch := range []string{"", "[]", " [ ] ", "\n\n"} {
+				request, _ := http.NewRequest(POST, "/pings/batch", bytes.NewBufferString(batch))
+
+				code, data, err := PingBatch{}.Post(app, request)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(code).Should(Equal(StatusUnprocessableEntity))
+				Ω(data).Should(HaveKeyWithValue("error", "no pings in the batch"))
+			}
+		})
+
+	})
+
+	Describe("roles", func() {
+
+		var router *mux.Router
+
+		BeforeEach(func() {
+			createNode(Node{Name: "apollo", Role: RoleReporter}, "apollosecretkey")
+			createNode(Node{Name: "artemis", Role: RoleAdmin}, "artemissecretkey")
+			createNode(Node{Name: "hermes", Role: RoleReadOnly}, "hermessecretkey")
+
+			router = mux.NewRouter()
+			for _, route := range []Route{
+				CreateResourceRoute(PingCollection{}, "PingCollection", "/pings"),
+				CreateResourceRoute(PingDetail{}, "PingDetail", "/pings/{ID}"),
+				CreateResourceRoute(NodeCollection{}, "NodeCollection", "/nodes"),
+			} {
+				router.Handle(route.Pattern, Authenticate(app, route.Handler(app)))
+			}
+		})
+
+		It("should only permit reporters to create their own pings", func() {
+			node, err := GetNodeByName(db, "apollo")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			body := bytes.NewBufferString(`{"target": 2, "latency": 12.3}`)
+			request := signedRequest(POST, "http://localhost:8080/pings", body, "apollo", "apollosecretkey")
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusCreated))
+
+			ping, err := GetPing(db, 1)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ping.Source).Should(Equal(node.ID))
+
+			for _, method := range []string{PUT, PATCH, DELETE} {
+				body := bytes.NewBufferString(`{"latency": 1.2}`)
+				request := signedRequest(method, "http://localhost:8080/pings/1", body, "apollo", "apollosecretkey")
+				response := httptest.NewRecorder()
+				router.ServeHTTP(response, request)
+				Ω(response.Code).Should(Equal(http.StatusForbidden), method)
+			}
+
+			body = bytes.NewBufferString(`{"name": "zeus"}`)
+			request = signedRequest(POST, "http://localhost:8080/nodes", body, "apollo", "apollosecretkey")
+			response = httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusForbidden))
+		})
+
+		It("should only permit read-only nodes to read", func() {
+			request := signedRequest(GET, "http://localhost:8080/pings", nil, "hermes", "hermessecretkey")
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusOK))
+
+			body := bytes.NewBufferString(`{"target": 2, "latency": 12.3}`)
+			request = signedRequest(POST, "http://localhost:8080/pings", body, "hermes", "hermessecretkey")
+			response = httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusForbidden))
+			Ω(response.Body.String()).Should(ContainSubstring(`role read-only is not permitted to POST /pings`))
+		})
+
+		It("should permit admins to change nodes and pings", func() {
+			body := bytes.NewBufferString(`{"name": "zeus", "role": "admin"}`)
+			request := signedRequest(POST, "http://localhost:8080/nodes", body, "artemis", "artemissecretkey")
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusCreated))
+			Ω(response.Body.String()).Should(ContainSubstring(`"role":"admin"`))
+
+			ping := &Ping{Source: 1, Target: 2}
+			_, err := ping.Save(db)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			request = signedRequest(DELETE, "http://localhost:8080/pings/1", nil, "artemis", "artemissecretkey")
+			response = httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusNoContent))
+		})
+
+	})
+
+	Describe("enrollment", func() {
+
+		var router *mux.Router
+
+		BeforeEach(func() {
+			createNode(Node{Name: "artemis", Role: RoleAdmin}, "artemissecretkey")
+			createNode(Node{Name: "apollo", Role: RoleReporter}, "apollosecretkey")
+
+			router = mux.NewRouter()
+			for _, route := range []Route{
+				CreateResourceRoute(NodeCollection{}, "NodeCollection", "/nodes"),
+				CreateResourceRoute(EnrollmentTokenCollection{}, "EnrollmentTokenCollection", "/enrollment-tokens"),
+				CreatePublicResourceRoute(EnrollmentResource{}, "Enrollment", "/enroll"),
+			} {
+				var handler http.Handler = route.Handler(app)
+				if route.Authorize {
+					handler = Authenticate(app, handler)
+				}
+				router.Handle(route.Pattern, handler)
+			}
+		})
+
+		// Helper function that enrolls a node with the token.
+		enroll := func(token, name string) *httptest.ResponseRecorder {
+			body := bytes.NewBufferString(`{"token": "` + token + `", "name": "` + name + `", "address": "10.0.0.5"}`)
+			request, err := http.NewRequest(POST, "http://localhost:8080/enroll", body)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			return response
+		}
+
+		It("should only permit admins to create enrollment tokens", func() {
+			body := bytes.NewBufferString(`{"role": "read-only", "ttl": "1h"}`)
+			request := signedRequest(POST, "http://localhost:8080/enrollment-tokens", body, "artemis", "artemissecretkey")
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusCreated))
+
+			var token EnrollmentToken
+			Ω(json.Unmarshal(response.Body.Bytes(), &token)).Should(Succeed())
+			Ω(token.Token).ShouldNot(BeEmpty())
+			Ω(token.Role).Should(Equal(RoleReadOnly))
+			Ω(token.Expires).Should(BeTemporally("~", token.Created.Add(time.Hour), time.Second))
+
+			for _, method := range []string{GET, POST} {
+				request := signedRequest(method, "http://localhost:8080/enrollment-tokens", nil, "apollo", "apollosecretkey")
+				response := httptest.NewRecorder()
+				router.ServeHTTP(response, request)
+				Ω(response.Code).Should(Equal(http.StatusForbidden), method)
+			}
+
+			request = signedRequest(GET, "http://localhost:8080/enrollment-tokens", nil, "artemis", "artemissecretkey")
+			response = httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusOK))
+			Ω(response.Body.String()).ShouldNot(ContainSubstring(token.Token))
+		})
+
+		It("should reject enrollment tokens with an invalid role or ttl", func() {
+			for _, body := range []string{`{"role": "superuser"}`, `{"ttl": "tomorrow"}`, `{"ttl": "-1h"}`} {
+				request := signedRequest(POST, "http://localhost:8080/enrollment-tokens", bytes.NewBufferString(body), "artemis", "artemissecretkey")
+				response := httptest.NewRecorder()
+				router.ServeHTTP(response, request)
+				Ω(response.Code).Should(Equal(StatusUnprocessableEntity), body)
+			}
+		})
+
+		It("should exchange a token for credentials that authenticate the node", func() {
+			token, err := CreateEnrollmentToken(db, RoleReporter, time.Hour)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			response := enroll(token.Token, "hermes")
+			Ω(response.Code).Should(Equal(http.StatusCreated))
+
+			var creds Credentials
+			Ω(json.Unmarshal(response.Body.Bytes(), &creds)).Should(Succeed())
+			Ω(creds.Node.Name).Should(Equal("hermes"))
+			Ω(creds.Node.Address).Should(Equal("10.0.0.5"))
+			Ω(creds.Node.Role).Should(Equal(RoleReporter))
+			Ω(creds.KeyID).ShouldNot(BeEmpty())
+			Ω(creds.Key).ShouldNot(BeEmpty())
+
+			request := signedRequest(GET, "http://localhost:8080/nodes", nil, creds.KeyID, creds.Key)
+			response = httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			Ω(response.Code).Should(Equal(http.StatusOK))
+
+			tokens, err := FetchEnrollmentTokens(db)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(tokens).Should(HaveLen(1))
+			Ω(tokens[0].Used).ShouldNot(BeNil())
+			Ω(*tokens[0].NodeID).Should(Equal(creds.Node.ID))
+		})
+
+		It("should only allow a token to be used once", func() {
+			token, err := CreateEnrollmentToken(db, "", 0)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(enroll(token.Token, "hermes").Code).Should(Equal(http.StatusCreated))
+			Ω(enroll(token.Token, "zeus").Code).Should(Equal(http.StatusForbidden))
+
+			_, err = GetNodeByName(db, "zeus")
+			Ω(IsNotFound(err)).Should(BeTrue())
+		})
+
+		It("should reject unknown and expired tokens", func() {
+			Ω(enroll("notatoken", "hermes").Code).Should(Equal(http.StatusForbidden))
+
+			token, err := CreateEnrollmentToken(db, RoleReporter, time.Hour)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = db.Exec("UPDATE enrollment_tokens SET expires=$1 WHERE id=$2", time.Now().Add(-time.Minute), token.ID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(enroll(token.Token, "hermes").Code).Should(Equal(http.StatusForbidden))
+		})
+
+		It("should not consume the token if the node can't be created", func() {
+			token, err := CreateEnrollmentToken(db, RoleReporter, time.Hour)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(enroll(token.Token, "apollo").Code).Should(Equal(http.StatusConflict))
+			Ω(enroll(token.Token, "").Code).Should(Equal(StatusUnprocessableEntity))
+			Ω(enroll(token.Token, "hermes").Code).Should(Equal(http.StatusCreated))
+		})
+
+	})
+
 })